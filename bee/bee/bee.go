@@ -1,11 +1,15 @@
 package bee
 
 import (
+	"errors"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // HandlerFunc define the handlerFunc used by bee
@@ -15,7 +19,29 @@ type HandlerFunc func(*Context)
 type Engine struct {
 	*RouterGroup
 	router *router
+	mu     sync.Mutex // protect groups and the middlewares of the groups
 	groups []*RouterGroup
+	chains atomic.Pointer[[]groupChain] // snapshot of groups used to serve the requests
+
+	trustedProxies []*net.IPNet
+	localized      *sync.Map // locale => clone of htmlTemplates translating to it, see templates
+	localizedCount atomic.Int32
+
+	// RedirectTrailingSlash redirects /users/ to /users if only the latter is registered and vice versa,
+	// off by default: /users/ is served by /users
+	RedirectTrailingSlash bool
+	// RedirectFixedPath redirects a path which isn't clean(/a//b, /a/./b) or has the wrong case to the registered one
+	RedirectFixedPath bool
+	// UseRawPath routes on the escaped path, so an encoded slash(%2F) stays in a param
+	UseRawPath bool
+	// UnescapePathValues unescapes the params when UseRawPath is set
+	UnescapePathValues bool
+}
+
+// groupChain is the immutable copy of the middlewares of a group
+type groupChain struct {
+	prefix      string
+	middlewares []HandlerFunc
 }
 
 // RouterGroup struct
@@ -30,29 +56,94 @@ type RouterGroup struct {
 
 func New() *Engine {
 	engine := &Engine{
-		router: newRouter(),
+		router:             newRouter(),
+		UnescapePathValues: true,
 	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
+	engine.publishGroups()
 	return engine
 }
 
+// publishGroups replaces the snapshot of groups read by ServeHTTP, e.mu must be held unless e isn't shared yet
+func (e *Engine) publishGroups() {
+	chains := make([]groupChain, 0, len(e.groups))
+	for _, group := range e.groups {
+		chains = append(chains, groupChain{
+			prefix:      group.prefix,
+			middlewares: append([]HandlerFunc(nil), group.middlewares...),
+		})
+	}
+	e.chains.Store(&chains)
+}
+
+// HTMLTemplates returns the templates loaded by LoadHTMLGlob
+func (e *Engine) HTMLTemplates() *template.Template {
+	t, err := e.templates(nil)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
 func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
 	e.funcMap = funcMap
 }
 
+// LoadHTMLGlob parses the templates, the function T translates a key with the translator of the Context
 func (e *Engine) LoadHTMLGlob(pattern string) {
-	e.htmlTemplates = template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern))
+	funcs := template.FuncMap{"T": func(key string, args ...interface{}) string { return key }}
+	for name, fn := range e.funcMap {
+		funcs[name] = fn
+	}
+	e.htmlTemplates = template.Must(template.New("").Funcs(funcs).ParseGlob(pattern))
+	e.localized = new(sync.Map)
+	e.localizedCount.Store(0)
+}
+
+// maxLocalized bounds the clones of the templates kept, one per locale
+const maxLocalized = 64
+
+// templates returns the clone of htmlTemplates whose T function uses the translator.
+// htmlTemplates itself is never executed, otherwise it can't be cloned anymore.
+// The clones are kept per locale, the translators of a locale are expected to translate alike.
+// Past maxLocalized locales the clones aren't kept anymore.
+func (e *Engine) templates(translator Translator) (*template.Template, error) {
+	if e.htmlTemplates == nil {
+		return nil, errors.New("bee: no templates loaded")
+	}
+	locale := ""
+	if translator != nil {
+		locale = translator.Locale()
+	}
+	if t, ok := e.localized.Load(locale); ok {
+		return t.(*template.Template), nil
+	}
+	clone, err := e.htmlTemplates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if translator != nil {
+		clone.Funcs(template.FuncMap{"T": translator.T})
+	}
+	if e.localizedCount.Load() >= maxLocalized {
+		return clone, nil
+	}
+	t, loaded := e.localized.LoadOrStore(locale, clone)
+	if !loaded {
+		e.localizedCount.Add(1)
+	}
+	return t.(*template.Template), nil
 }
 
 // GET request register
-func (e *Engine) GET(pattern string, handler HandlerFunc) {
-	e.router.addRoute("GET", pattern, handler)
+func (e *Engine) GET(pattern string, handler HandlerFunc) *Route {
+	return e.router.addRoute("GET", pattern, handler, e.RouterGroup)
 }
 
 // POST request register
-func (e *Engine) POST(pattern string, handler HandlerFunc) {
-	e.router.addRoute("POST", pattern, handler)
+func (e *Engine) POST(pattern string, handler HandlerFunc) *Route {
+	return e.router.addRoute("POST", pattern, handler, e.RouterGroup)
 }
 
 // Run to start blkcor http server
@@ -63,15 +154,47 @@ func (e *Engine) Run(addr string) (err error) {
 // impl the interface http.Handler
 func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var middlewares []HandlerFunc
-	for _, group := range e.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
+	// 路由忽略空的路径段，中间件也要按同样的路径匹配，否则 //admin 会绕过 /admin 分组的中间件
+	urlPath := collapseSlashes(req.URL.Path)
+	for _, chain := range *e.chains.Load() {
+		if strings.HasPrefix(urlPath, chain.prefix) {
+			middlewares = append(middlewares, chain.middlewares...)
 		}
 	}
+	e.router.handle(e.NewContext(w, req, middlewares...))
+}
+
+// collapseSlashes removes the empty segments of the path like parsePattern does, keeping the trailing slash
+func collapseSlashes(p string) string {
+	if !strings.Contains(p, "//") {
+		return p
+	}
+	collapsed := "/" + strings.Join(strings.FieldsFunc(p, func(r rune) bool { return r == '/' }), "/")
+	if collapsed != "/" && strings.HasSuffix(p, "/") {
+		collapsed += "/"
+	}
+	return collapsed
+}
+
+// Chain returns a handler calling the handlers in order, like the middlewares of a route:
+// each one continues with c.Next and stops the chain with c.Abort. Chain(guard, handler) protects
+// a single route, the guard can't be skipped by a path the prefix of a group doesn't match.
+func Chain(handlers ...HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		outer, index := c.handlers, c.index
+		c.handlers, c.index = handlers, -1
+		c.Next()
+		c.handlers, c.index = outer, index
+	}
+}
+
+// NewContext creates a Context bound to the engine, the handlers are called in order once Next is called.
+// It's useful to test a single middleware without routing.
+func (e *Engine) NewContext(w http.ResponseWriter, req *http.Request, handlers ...HandlerFunc) *Context {
 	context := newContext(w, req)
-	context.handlers = middlewares
+	context.handlers = handlers
 	context.engine = e
-	e.router.handle(context)
+	return context
 }
 
 func (rg *RouterGroup) Group(prefix string) *RouterGroup {
@@ -82,29 +205,69 @@ func (rg *RouterGroup) Group(prefix string) *RouterGroup {
 		engine: engine,
 	}
 	//append to parent.groups
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
 	engine.groups = append(engine.groups, newGroup)
+	engine.publishGroups()
 	return newGroup
 }
 
 func (rg *RouterGroup) Use(middlewares ...HandlerFunc) {
+	rg.engine.mu.Lock()
+	defer rg.engine.mu.Unlock()
 	rg.middlewares = append(rg.middlewares, middlewares...)
+	rg.engine.publishGroups()
+}
+
+// RemoveGroup removes the group, the groups created from it and the routes registered in them.
+// It's safe to call while serving. The root group of the engine can't be removed.
+func (e *Engine) RemoveGroup(group *RouterGroup) int {
+	if group == e.RouterGroup || group.engine != e {
+		return 0
+	}
+	e.mu.Lock()
+	groups := make([]*RouterGroup, 0, len(e.groups))
+	for _, g := range e.groups {
+		if !g.within(group) {
+			groups = append(groups, g)
+		}
+	}
+	e.groups = groups
+	e.publishGroups()
+	e.mu.Unlock()
+	return e.router.removeGroup(group)
+}
+
+// within reports whether rg is group or was created from it
+func (rg *RouterGroup) within(group *RouterGroup) bool {
+	for g := rg; g != nil; g = g.parent {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveRoute removes the route registered with the method and pattern in the group.
+// It's safe to call while serving.
+func (rg *RouterGroup) RemoveRoute(method, pattern string) bool {
+	return rg.engine.router.removeRoute(method, rg.prefix+pattern)
 }
 
 // addRoute add route to the RouterGroup
-func (rg *RouterGroup) addRoute(method, comp string, handler HandlerFunc) {
+func (rg *RouterGroup) addRoute(method, comp string, handler HandlerFunc) *Route {
 	//v1 := route.Group("/v1"); v1.GET("/hello") => comp is /hello and the actual pattern is /v1/hello
-	pattern := rg.engine.prefix + comp
-	rg.engine.router.addRoute(method, pattern, handler)
+	pattern := rg.prefix + comp
+	return rg.engine.router.addRoute(method, pattern, handler, rg)
 }
 
-func (rg *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	// Call with rg.engine
-	// So we just need to add the route rule tu engine
-	rg.engine.addRoute("GET", rg.prefix+pattern, handler)
+// GET registers a GET route, the returned Route can be used to describe it for the OpenAPI document
+func (rg *RouterGroup) GET(pattern string, handler HandlerFunc) *Route {
+	return rg.addRoute("GET", pattern, handler)
 }
 
-func (rg *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	rg.engine.addRoute("POST", rg.prefix+pattern, handler)
+func (rg *RouterGroup) POST(pattern string, handler HandlerFunc) *Route {
+	return rg.addRoute("POST", pattern, handler)
 }
 
 // createStaticHandler create blkcor handler to serve static files
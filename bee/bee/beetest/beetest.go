@@ -0,0 +1,156 @@
+package beetest
+
+import (
+	"bee"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Client sends requests to an Engine in process, no network is involved
+type Client struct {
+	t      testing.TB
+	engine *bee.Engine
+	header http.Header
+}
+
+// New creates a Client for the engine, failed assertions are reported to t
+func New(t testing.TB, engine *bee.Engine) *Client {
+	return &Client{
+		t:      t,
+		engine: engine,
+		header: make(http.Header),
+	}
+}
+
+// WithHeader sets a header sent with every request of the client
+func (c *Client) WithHeader(key, value string) *Client {
+	c.header.Set(key, value)
+	return c
+}
+
+func (c *Client) GET(path string) *Request {
+	return c.Request(http.MethodGet, path)
+}
+
+func (c *Client) POST(path string) *Request {
+	return c.Request(http.MethodPost, path)
+}
+
+func (c *Client) PUT(path string) *Request {
+	return c.Request(http.MethodPut, path)
+}
+
+func (c *Client) DELETE(path string) *Request {
+	return c.Request(http.MethodDelete, path)
+}
+
+// Request starts building a request with any method
+func (c *Client) Request(method, path string) *Request {
+	return &Request{
+		client: c,
+		method: method,
+		path:   path,
+		header: c.header.Clone(),
+		query:  make(url.Values),
+	}
+}
+
+// Request is a request under construction, call Do to send it
+type Request struct {
+	client *Client
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   io.Reader
+	err    error
+}
+
+// WithHeader sets a request header
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter to the url
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody uses the raw data as request body
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = bytes.NewReader(body)
+	return r
+}
+
+// WithJSON encodes obj as the request body
+func (r *Request) WithJSON(obj interface{}) *Request {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	return r.WithBody("application/json", data)
+}
+
+// WithForm encodes the values as an url-encoded form body
+func (r *Request) WithForm(values url.Values) *Request {
+	return r.WithBody("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// Build returns the http.Request without sending it
+func (r *Request) Build() *http.Request {
+	r.client.t.Helper()
+	if r.err != nil {
+		r.client.t.Fatalf("beetest: build %s %s: %v", r.method, r.path, r.err)
+	}
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req := httptest.NewRequest(r.method, target, r.body)
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	return req
+}
+
+// Do runs the request through the engine and returns the recorded response
+func (r *Request) Do() *Response {
+	r.client.t.Helper()
+	req := r.Build()
+	rec := httptest.NewRecorder()
+	r.client.engine.ServeHTTP(rec, req)
+	return &Response{
+		ResponseRecorder: rec,
+		t:                r.client.t,
+		engine:           r.client.engine,
+	}
+}
+
+// NewContext creates a Context for unit testing middlewares, the handlers run in order once Next is called.
+// The returned recorder holds what the handlers wrote.
+func NewContext(req *http.Request, handlers ...bee.HandlerFunc) (*bee.Context, *httptest.ResponseRecorder) {
+	if req == nil {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+	}
+	rec := httptest.NewRecorder()
+	return bee.New().NewContext(rec, req, handlers...), rec
+}
+
+// Record wraps a recorder filled outside of the Client, e.g. by NewContext, to assert on it
+func Record(t testing.TB, rec *httptest.ResponseRecorder) *Response {
+	return &Response{ResponseRecorder: rec, t: t}
+}
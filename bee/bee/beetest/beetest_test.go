@@ -0,0 +1,81 @@
+package beetest
+
+import (
+	"bee"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type student struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newTestEngine(t *testing.T) *bee.Engine {
+	dir := t.TempDir()
+	tmpl := `{{define "hello.tmpl"}}<p>hello {{.}}</p>{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "hello.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := bee.New()
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.GET("/hello/:name", func(c *bee.Context) {
+		c.SetHeader("X-Name", c.Param("name"))
+		c.String(http.StatusOK, "hello %s, you're at %s", c.Param("name"), c.Query("from"))
+	})
+	r.POST("/students", func(c *bee.Context) {
+		var s student
+		if err := json.NewDecoder(c.Req.Body).Decode(&s); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, bee.H{"data": []student{s}, "token": c.Req.Header.Get("X-Token")})
+	})
+	r.GET("/page/:name", func(c *bee.Context) {
+		c.HTML(http.StatusOK, "hello.tmpl", c.Param("name"))
+	})
+	return r
+}
+
+func TestClient(t *testing.T) {
+	c := New(t, newTestEngine(t))
+
+	c.GET("/hello/bee").WithQuery("from", "home").Do().
+		Status(http.StatusOK).
+		Header("X-Name", "bee").
+		BodyEquals("hello bee, you're at home")
+
+	c.POST("/students").WithJSON(student{Name: "Jack", Age: 22}).WithHeader("X-Token", "t1").Do().
+		Status(http.StatusCreated).
+		Header("Content-Type", "application/json").
+		JSON("data.0.name", "Jack").
+		JSON("data.0", student{Name: "Jack", Age: 22}).
+		JSON("token", "t1")
+
+	c.GET("/page/bee").Do().Status(http.StatusOK).HTML("hello.tmpl", "bee")
+
+	c.GET("/missing").Do().Status(http.StatusNotFound).BodyContains("404 NOT FOUND")
+}
+
+func TestNewContext(t *testing.T) {
+	var order []string
+	middleware := func(c *bee.Context) {
+		order = append(order, "before")
+		c.Next()
+		order = append(order, "after")
+	}
+	final := func(c *bee.Context) {
+		order = append(order, "handler")
+		c.String(http.StatusTeapot, "done")
+	}
+	c, rec := NewContext(nil, middleware, final)
+	c.Next()
+
+	if len(order) != 3 || order[0] != "before" || order[1] != "handler" || order[2] != "after" {
+		t.Fatalf("unexpected call order %v", order)
+	}
+	Record(t, rec).Status(http.StatusTeapot).BodyEquals("done")
+}
@@ -0,0 +1,144 @@
+package beetest
+
+import (
+	"bee"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Response is a recorded response with chainable assertions
+type Response struct {
+	*httptest.ResponseRecorder
+	t      testing.TB
+	engine *bee.Engine
+}
+
+// Status asserts the status code
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Code != code {
+		r.t.Errorf("beetest: status = %d, want %d, body: %s", r.Code, code, r.Body.String())
+	}
+	return r
+}
+
+// Header asserts the value of a response header
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Result().Header.Get(key); got != value {
+		r.t.Errorf("beetest: header %s = %q, want %q", key, got, value)
+	}
+	return r
+}
+
+// BodyContains asserts the body contains the sub string
+func (r *Response) BodyContains(sub string) *Response {
+	r.t.Helper()
+	if !strings.Contains(r.Body.String(), sub) {
+		r.t.Errorf("beetest: body %q doesn't contain %q", r.Body.String(), sub)
+	}
+	return r
+}
+
+// BodyEquals asserts the whole body
+func (r *Response) BodyEquals(body string) *Response {
+	r.t.Helper()
+	if got := r.Body.String(); got != body {
+		r.t.Errorf("beetest: body = %q, want %q", got, body)
+	}
+	return r
+}
+
+// JSON asserts the value found at path in the json body.
+// path is dot separated, array elements are addressed by index, eg "data.items.0.name".
+// An empty path matches the whole document.
+func (r *Response) JSON(path string, want interface{}) *Response {
+	r.t.Helper()
+	got, err := r.lookup(path)
+	if err != nil {
+		r.t.Errorf("beetest: json path %q: %v", path, err)
+		return r
+	}
+	normalized, err := normalize(want)
+	if err != nil {
+		r.t.Errorf("beetest: json path %q: encode expected value: %v", path, err)
+		return r
+	}
+	if !reflect.DeepEqual(got, normalized) {
+		r.t.Errorf("beetest: json path %q = %v, want %v", path, got, normalized)
+	}
+	return r
+}
+
+// DecodeJSON decodes the body into v
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Errorf("beetest: decode json body: %v", err)
+	}
+	return r
+}
+
+// HTML asserts the body is the named template of the engine rendered with data
+func (r *Response) HTML(name string, data interface{}) *Response {
+	r.t.Helper()
+	if r.engine == nil || r.engine.HTMLTemplates() == nil {
+		r.t.Errorf("beetest: engine has no templates loaded")
+		return r
+	}
+	var buf bytes.Buffer
+	if err := r.engine.HTMLTemplates().ExecuteTemplate(&buf, name, data); err != nil {
+		r.t.Errorf("beetest: render template %s: %v", name, err)
+		return r
+	}
+	if got := r.Body.String(); got != buf.String() {
+		r.t.Errorf("beetest: body isn't template %s, got %q, want %q", name, got, buf.String())
+	}
+	return r
+}
+
+func (r *Response) lookup(path string) (interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &doc); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return doc, nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[part]
+			if !ok {
+				return nil, fmt.Errorf("no such key %q", part)
+			}
+			doc = value
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("bad array index %q", part)
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", part)
+		}
+	}
+	return doc, nil
+}
+
+// normalize converts v to the generic form produced by json.Unmarshal
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
@@ -1,6 +1,8 @@
 package bee
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,17 +10,26 @@ import (
 
 type H map[string]interface{}
 
+// Translator translates message keys for a locale, it's set on the Context by an i18n middleware
+type Translator interface {
+	Locale() string
+	T(key string, args ...interface{}) string
+}
+
 type Context struct {
 	Req        *http.Request
 	Writer     http.ResponseWriter
 	Path       string
 	Method     string
 	Params     map[string]string
+	Pattern    string // the pattern of the matched route, empty if no route matched
 	StatusCode int
 	//middleware
 	handlers []HandlerFunc
 	index    int
 	engine   *Engine
+	//i18n
+	translator Translator
 }
 
 func (ctx *Context) Param(key string) string {
@@ -44,6 +55,45 @@ func (ctx *Context) Next() {
 	}
 }
 
+// ClientCertificate returns the verified certificate presented by the client in mutual tls mode
+func (ctx *Context) ClientCertificate() (*x509.Certificate, bool) {
+	state := ctx.Req.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return state.VerifiedChains[0][0], true
+}
+
+// ClientCertSubject returns the subject of the verified client certificate
+func (ctx *Context) ClientCertSubject() (pkix.Name, bool) {
+	cert, ok := ctx.ClientCertificate()
+	if !ok {
+		return pkix.Name{}, false
+	}
+	return cert.Subject, true
+}
+
+// SetTranslator sets the translator used by T and the T function of the templates
+func (ctx *Context) SetTranslator(translator Translator) {
+	ctx.translator = translator
+}
+
+// Locale returns the locale of the translator, empty if none is set
+func (ctx *Context) Locale() string {
+	if ctx.translator == nil {
+		return ""
+	}
+	return ctx.translator.Locale()
+}
+
+// T translates the key, the key itself is returned if no translator is set
+func (ctx *Context) T(key string, args ...interface{}) string {
+	if ctx.translator == nil {
+		return key
+	}
+	return ctx.translator.T(key, args...)
+}
+
 // PostForm get the form value
 func (ctx *Context) PostForm(key string) string {
 	return ctx.Req.FormValue(key)
@@ -54,9 +104,14 @@ func (ctx *Context) Query(key string) string {
 	return ctx.Req.URL.Query().Get(key)
 }
 
+// Abort prevents the pending handlers from being called
+func (ctx *Context) Abort() {
+	ctx.index = len(ctx.handlers)
+}
+
 func (ctx *Context) Fail(code int, msg string) {
 	//prevent to call other handlers
-	ctx.index = len(ctx.handlers)
+	ctx.Abort()
 	ctx.JSON(code, H{"message": msg})
 }
 
@@ -98,7 +153,12 @@ func (ctx *Context) Data(code int, data []byte) {
 func (ctx *Context) HTML(code int, name string, data interface{}) {
 	ctx.SetHeader("Content-Type", "text/html")
 	ctx.Status(code)
-	if err := ctx.engine.htmlTemplates.ExecuteTemplate(ctx.Writer, name, data); err != nil {
+	tmpl, err := ctx.engine.templates(ctx.translator)
+	if err != nil {
+		ctx.Fail(500, err.Error())
+		return
+	}
+	if err := tmpl.ExecuteTemplate(ctx.Writer, name, data); err != nil {
 		ctx.Fail(500, err.Error())
 	}
 }
@@ -0,0 +1,50 @@
+package bee
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mapTranslator isn't comparable, a new one is created for each request
+type mapTranslator struct {
+	locale   string
+	messages map[string]string
+}
+
+func (m mapTranslator) Locale() string { return m.locale }
+
+func (m mapTranslator) T(key string, args ...interface{}) string { return m.messages[key] }
+
+func TestLocalizedTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.tmpl"), []byte(`{{define "hello.tmpl"}}{{ T "hello" }}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.LoadHTMLGlob(filepath.Join(dir, "*"))
+	messages := map[string]map[string]string{"en": {"hello": "Hello"}, "fr": {"hello": "Bonjour"}}
+	e.Use(func(c *Context) {
+		locale := c.Query("lang")
+		c.SetTranslator(mapTranslator{locale: locale, messages: messages[locale]})
+	})
+	e.GET("/hello", func(c *Context) { c.HTML(http.StatusOK, "hello.tmpl", nil) })
+
+	for i := 0; i < 10; i++ {
+		for locale, want := range map[string]string{"en": "Hello", "fr": "Bonjour"} {
+			if w := serveTest(e, "GET", "/hello?lang="+locale); w.Body.String() != want {
+				t.Fatalf("%s: expect %q, got %q", locale, want, w.Body.String())
+			}
+		}
+	}
+	if n := e.localizedCount.Load(); n != 2 {
+		t.Fatalf("expect the templates cloned once per locale, got %d clones", n)
+	}
+	for i := 0; i < 2*maxLocalized; i++ {
+		serveTest(e, "GET", "/hello?lang=x"+string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+	if n := e.localizedCount.Load(); n != maxLocalized {
+		t.Fatalf("expect at most %d clones kept, got %d", maxLocalized, n)
+	}
+}
@@ -1,3 +1,13 @@
 module bee
 
-go 1.22
\ No newline at end of file
+go 1.24
+
+require (
+	beeCache v0.0.0
+	github.com/blkcor/beeCache v0.0.0
+)
+
+replace (
+	beeCache => ../../beeCache/beeCache
+	github.com/blkcor/beeCache => ../../beeCache
+)
@@ -0,0 +1,41 @@
+package health
+
+import (
+	"bee"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// RegisterDebug exposes pprof under /pprof/ and expvar under /vars of the group.
+// The endpoints leak internals and allow costly profiling, so the guard(eg. middlewares.BasicAuth) is required.
+// It's chained to each endpoint rather than used by the group, so no path can skip it.
+func RegisterDebug(g *bee.RouterGroup, guard bee.HandlerFunc) {
+	if guard == nil {
+		panic("health: debug endpoints must be protected by a guard")
+	}
+	g.GET("/pprof/", bee.Chain(guard, wrap(http.HandlerFunc(pprof.Index))))
+	g.GET("/pprof/*name", bee.Chain(guard, func(c *bee.Context) {
+		var handler http.Handler
+		switch name := c.Param("name"); name {
+		case "cmdline":
+			handler = http.HandlerFunc(pprof.Cmdline)
+		case "profile":
+			handler = http.HandlerFunc(pprof.Profile)
+		case "symbol":
+			handler = http.HandlerFunc(pprof.Symbol)
+		case "trace":
+			handler = http.HandlerFunc(pprof.Trace)
+		default:
+			handler = pprof.Handler(name)
+		}
+		handler.ServeHTTP(c.Writer, c.Req)
+	}))
+	g.GET("/vars", bee.Chain(guard, wrap(expvar.Handler())))
+}
+
+func wrap(handler http.Handler) bee.HandlerFunc {
+	return func(c *bee.Context) {
+		handler.ServeHTTP(c.Writer, c.Req)
+	}
+}
@@ -0,0 +1,198 @@
+// Package health registers liveness and readiness routes and the debug endpoints on a bee Engine.
+package health
+
+import (
+	"bee"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLivePath  = "/healthz"
+	DefaultReadyPath = "/readyz"
+	defaultTimeout   = time.Second * 5
+)
+
+// Checker reports whether a dependency is healthy, it should return once ctx is done
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Pinger is implemented by *sql.DB and beeORM's Engine
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping checks a database, eg. Ping(db) or Ping(beeormEngine)
+func Ping(p Pinger) Checker {
+	return CheckerFunc(p.PingContext)
+}
+
+// TCPDial checks an address accepts connections, eg. a beeCache peer
+func TCPDial(addr string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPGet checks an url answers with a status below 500
+func HTTPGet(url string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("server returned: %v", resp.Status)
+		}
+		return nil
+	})
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report aggregates the results, Status is "ok" only if every check passed
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Health holds the liveness and readiness checks
+type Health struct {
+	// Timeout bounds every check, a check running longer fails
+	Timeout   time.Duration
+	LivePath  string
+	ReadyPath string
+	mu        sync.RWMutex // protect following
+	liveness  map[string]Checker
+	readiness map[string]Checker
+}
+
+// New creates a Health serving on the default paths
+func New() *Health {
+	return &Health{
+		Timeout:   defaultTimeout,
+		LivePath:  DefaultLivePath,
+		ReadyPath: DefaultReadyPath,
+		liveness:  make(map[string]Checker),
+		readiness: make(map[string]Checker),
+	}
+}
+
+// AddLiveness adds a check telling whether the process should be restarted
+func (h *Health) AddLiveness(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = checker
+}
+
+// AddReadiness adds a check telling whether the process can serve traffic
+func (h *Health) AddReadiness(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness[name] = checker
+}
+
+// Register registers the liveness and readiness routes on the group
+func (h *Health) Register(g *bee.RouterGroup) {
+	g.GET(h.LivePath, h.handler(&h.liveness)).
+		Summary("liveness probe").Tags("health").Response(http.StatusOK, Report{}).Response(http.StatusServiceUnavailable, Report{})
+	g.GET(h.ReadyPath, h.handler(&h.readiness)).
+		Summary("readiness probe").Tags("health").Response(http.StatusOK, Report{}).Response(http.StatusServiceUnavailable, Report{})
+}
+
+func (h *Health) handler(checkers *map[string]Checker) bee.HandlerFunc {
+	return func(c *bee.Context) {
+		h.mu.RLock()
+		snapshot := make(map[string]Checker, len(*checkers))
+		for name, checker := range *checkers {
+			snapshot[name] = checker
+		}
+		h.mu.RUnlock()
+		report := h.Run(c.Req.Context(), snapshot)
+		code := http.StatusOK
+		if report.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		c.SetHeader("Cache-Control", "no-store")
+		c.JSON(code, report)
+	}
+}
+
+// Run runs the checkers concurrently, each one bounded by Timeout
+func (h *Health) Run(ctx context.Context, checkers map[string]Checker) Report {
+	report := Report{Status: "ok", Checks: make(map[string]Result, len(checkers))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+			result := h.check(ctx, checker)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != "ok" {
+				report.Status = "fail"
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+	return report
+}
+
+// check runs a checker, it gives up waiting once the timeout is reached even if the checker ignores ctx
+func (h *Health) check(ctx context.Context, checker Checker) Result {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- checker.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := Result{Status: "ok", Latency: time.Since(start).String()}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timeout after %v", timeout)
+		}
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	return result
+}
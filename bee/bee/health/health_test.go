@@ -0,0 +1,56 @@
+package health
+
+import (
+	"bee"
+	"bee/beetest"
+	"bee/middlewares"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	h := New()
+	h.Timeout = 50 * time.Millisecond
+	h.AddLiveness("self", CheckerFunc(func(ctx context.Context) error { return nil }))
+	h.AddReadiness("db", CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+	h.AddReadiness("slow", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second) // ignores ctx on purpose
+		return nil
+	}))
+	r := bee.New()
+	h.Register(r.RouterGroup)
+	client := beetest.New(t, r)
+
+	client.GET("/healthz").Do().Status(http.StatusOK).JSON("status", "ok").JSON("checks.self.status", "ok")
+
+	start := time.Now()
+	client.GET("/readyz").Do().Status(http.StatusServiceUnavailable).
+		JSON("status", "fail").
+		JSON("checks.db.error", "connection refused").
+		JSON("checks.slow.error", "timeout after 50ms")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("slow checker should be abandoned at the timeout, took %v", elapsed)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	r := bee.New()
+	RegisterDebug(r.Group("/debug"), middlewares.BasicAuth("debug", map[string]string{"admin": "secret"}))
+	client := beetest.New(t, r)
+
+	client.GET("/debug/vars").Do().Status(http.StatusUnauthorized)
+	// the empty segments are ignored by the router, they must not skip the guard
+	client.GET("//debug/vars").Do().Status(http.StatusUnauthorized)
+	client.GET("//debug/pprof/cmdline").Do().Status(http.StatusUnauthorized)
+	client.GET("/debug//pprof/").Do().Status(http.StatusUnauthorized)
+	authorized := beetest.New(t, r).WithHeader("Authorization", "Basic YWRtaW46c2VjcmV0")
+	authorized.GET("/debug/vars").Do().
+		Status(http.StatusOK).BodyContains("memstats")
+	authorized.GET("/debug/pprof/").Do().
+		Status(http.StatusOK).BodyContains("goroutine")
+	authorized.GET("/debug/pprof/goroutine").WithQuery("debug", "1").Do().
+		Status(http.StatusOK).BodyContains("goroutine profile")
+}
@@ -0,0 +1,259 @@
+// Package i18n negotiates the locale of bee requests and translates messages loaded from JSON or TOML catalogs.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Message is a translated message, One, Few... are the CLDR plural forms, Other is used when the form is missing
+type Message struct {
+	Zero  string
+	One   string
+	Two   string
+	Few   string
+	Many  string
+	Other string
+}
+
+func (m Message) form(category string) string {
+	var s string
+	switch category {
+	case "zero":
+		s = m.Zero
+	case "one":
+		s = m.One
+	case "two":
+		s = m.Two
+	case "few":
+		s = m.Few
+	case "many":
+		s = m.Many
+	}
+	if s == "" {
+		s = m.Other
+	}
+	return s
+}
+
+// Bundle holds the message catalogs of all locales
+type Bundle struct {
+	defaultLocale string
+	mu            sync.RWMutex // protect following
+	messages      map[string]map[string]Message
+	localizers    map[string]*Localizer
+}
+
+// NewBundle creates a Bundle, defaultLocale is used when no requested locale is supported
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		defaultLocale: defaultLocale,
+		messages:      make(map[string]map[string]Message),
+		localizers:    make(map[string]*Localizer),
+	}
+}
+
+// LoadFile loads a catalog, the locale is the file name and the format its extension, eg. zh-CN.toml
+func (b *Bundle) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(path)
+	return b.LoadMessages(strings.TrimSuffix(filepath.Base(path), ext), data, strings.TrimPrefix(ext, "."))
+}
+
+// LoadGlob loads all the catalogs matching the pattern
+func (b *Bundle) LoadGlob(pattern string) error {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := b.LoadFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadMessages loads a catalog in the format "json" or "toml".
+// A key maps to a message or to a table of plural forms(one, other...), other tables are flattened with dots.
+func (b *Bundle) LoadMessages(locale string, data []byte, format string) error {
+	var doc map[string]interface{}
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(data, &doc)
+	case "toml":
+		doc, err = parseTOML(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("i18n: load %s: %v", locale, err)
+	}
+	messages := make(map[string]Message)
+	if err := flatten("", doc, messages); err != nil {
+		return fmt.Errorf("i18n: load %s: %v", locale, err)
+	}
+	b.AddMessages(locale, messages)
+	return nil
+}
+
+// AddMessages adds messages to the catalog of the locale
+func (b *Bundle) AddMessages(locale string, messages map[string]Message) {
+	locale = canonical(locale)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	catalog, ok := b.messages[locale]
+	if !ok {
+		catalog = make(map[string]Message)
+		b.messages[locale] = catalog
+	}
+	for key, message := range messages {
+		catalog[key] = message
+	}
+}
+
+var pluralForms = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+func flatten(prefix string, doc map[string]interface{}, messages map[string]Message) error {
+	for key, value := range doc {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case string:
+			messages[key] = Message{Other: v}
+		case map[string]interface{}:
+			if isPlural(v) {
+				m := Message{}
+				m.Zero, _ = v["zero"].(string)
+				m.One, _ = v["one"].(string)
+				m.Two, _ = v["two"].(string)
+				m.Few, _ = v["few"].(string)
+				m.Many, _ = v["many"].(string)
+				m.Other, _ = v["other"].(string)
+				messages[key] = m
+				continue
+			}
+			if err := flatten(key, v, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s isn't a string", key)
+		}
+	}
+	return nil
+}
+
+// isPlural reports whether the table holds the plural forms of a message
+func isPlural(table map[string]interface{}) bool {
+	if _, ok := table["other"].(string); !ok {
+		return false
+	}
+	for key := range table {
+		if !pluralForms[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Locales returns the locales having a catalog
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	locales := make([]string, 0, len(b.messages))
+	for locale := range b.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Match returns the first supported locale of the candidates, in order of preference.
+// zh-TW falls back to zh and zh to zh-CN when they aren't supported exactly. The default locale is returned otherwise.
+func (b *Bundle) Match(candidates ...string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, candidate := range candidates {
+		candidate = canonical(candidate)
+		if candidate == "" {
+			continue
+		}
+		if _, ok := b.messages[candidate]; ok {
+			return candidate
+		}
+		base := baseLanguage(candidate)
+		if _, ok := b.messages[base]; ok {
+			return base
+		}
+		var regional []string
+		for locale := range b.messages {
+			if baseLanguage(locale) == base {
+				regional = append(regional, locale)
+			}
+		}
+		if len(regional) > 0 {
+			sort.Strings(regional)
+			return regional[0]
+		}
+	}
+	return canonical(b.defaultLocale)
+}
+
+// Localizer returns the translator of the locale
+func (b *Bundle) Localizer(locale string) *Localizer {
+	locale = canonical(locale)
+	b.mu.RLock()
+	l, ok := b.localizers[locale]
+	b.mu.RUnlock()
+	if ok {
+		return l
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l, ok = b.localizers[locale]; !ok {
+		l = &Localizer{bundle: b, locale: locale}
+		b.localizers[locale] = l
+	}
+	return l
+}
+
+// lookup finds the message in the locale, then its base language, then the default locale
+func (b *Bundle) lookup(locale, key string) (Message, string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range []string{locale, baseLanguage(locale), canonical(b.defaultLocale)} {
+		if message, ok := b.messages[l][key]; ok {
+			return message, l, true
+		}
+	}
+	return Message{}, "", false
+}
+
+// canonical normalizes a locale like zh_cn to zh-CN
+func canonical(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func baseLanguage(locale string) string {
+	base, _, _ := strings.Cut(locale, "-")
+	return base
+}
@@ -0,0 +1,150 @@
+package i18n
+
+import (
+	"bee"
+	"bee/beetest"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const enJSON = `{
+	"hello": "Hello, {name}!",
+	"apples": {"one": "{count} apple", "other": "{count} apples"},
+	"menu": {"home": "Home"}
+}`
+
+const zhTOML = `
+# 简体中文
+hello = "你好，{name}！"
+apples.other = "{count} 个苹果"
+
+[menu]
+home = '首页'
+`
+
+const ruTOML = `
+[files]
+one = "{count} файл"
+few = "{count} файла"
+many = "{count} файлов"
+other = "{count} файла"
+`
+
+func newTestBundle(t *testing.T) *Bundle {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"en.json": enJSON, "zh-CN.toml": zhTOML, "ru.toml": ruTOML} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := NewBundle("en")
+	if err := b.LoadGlob(filepath.Join(dir, "*")); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLocalizer(t *testing.T) {
+	b := newTestBundle(t)
+	if locales := b.Locales(); !reflect.DeepEqual(locales, []string{"en", "ru", "zh-CN"}) {
+		t.Fatalf("unexpected locales %v", locales)
+	}
+	en, zh, ru := b.Localizer("en"), b.Localizer("zh_cn"), b.Localizer("ru")
+	tests := []struct {
+		l    *Localizer
+		key  string
+		args []interface{}
+		want string
+	}{
+		{en, "hello", []interface{}{"name", "bee"}, "Hello, bee!"},
+		{en, "hello", []interface{}{map[string]interface{}{"name": "bee"}}, "Hello, bee!"},
+		{en, "apples", []interface{}{"count", 1}, "1 apple"},
+		{en, "apples", []interface{}{"count", 2}, "2 apples"},
+		{en, "menu.home", nil, "Home"},
+		{en, "missing", nil, "missing"},
+		{zh, "hello", []interface{}{"name", "bee"}, "你好，bee！"},
+		{zh, "apples", []interface{}{"count", 1}, "1 个苹果"},
+		{zh, "menu.home", nil, "首页"},
+		{ru, "files", []interface{}{"count", 1}, "1 файл"},
+		{ru, "files", []interface{}{"count", 3}, "3 файла"},
+		{ru, "files", []interface{}{"count", 11}, "11 файлов"},
+		{ru, "files", []interface{}{"count", 22}, "22 файла"},
+		{ru, "hello", []interface{}{"name", "bee"}, "Hello, bee!"},
+	}
+	for _, tt := range tests {
+		if got := tt.l.T(tt.key, tt.args...); got != tt.want {
+			t.Errorf("%s T(%q, %v) = %q, want %q", tt.l.Locale(), tt.key, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	b := newTestBundle(t)
+	tests := []struct {
+		candidates []string
+		want       string
+	}{
+		{[]string{"zh-CN"}, "zh-CN"},
+		{[]string{"zh-TW"}, "zh-CN"},
+		{[]string{"de", "ru-RU"}, "ru"},
+		{[]string{"de"}, "en"},
+		{ParseAcceptLanguage("de;q=0.9, zh;q=0.8, en;q=0.5"), "zh-CN"},
+		{ParseAcceptLanguage("ru;q=0, *"), "en"},
+	}
+	for _, tt := range tests {
+		if got := b.Match(tt.candidates...); got != tt.want {
+			t.Errorf("Match(%v) = %q, want %q", tt.candidates, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := `{{define "hello.tmpl"}}{{ T "hello" "name" . }} {{ T "menu.home" }}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "hello.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := bee.New()
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.Use(Middleware(newTestBundle(t), DefaultOptions))
+	r.GET("/hello/:name", func(c *bee.Context) {
+		c.String(http.StatusOK, "%s", c.T("hello", "name", c.Param("name")))
+	})
+	r.GET("/page/:name", func(c *bee.Context) {
+		c.HTML(http.StatusOK, "hello.tmpl", c.Param("name"))
+	})
+	client := beetest.New(t, r)
+
+	client.GET("/hello/bee").Do().Header("Content-Language", "en").BodyEquals("Hello, bee!")
+	client.GET("/hello/bee").WithHeader("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8").Do().
+		Header("Content-Language", "zh-CN").BodyEquals("你好，bee！")
+	client.GET("/hello/bee").WithHeader("Accept-Language", "zh-CN").WithHeader("Cookie", "lang=ru").Do().
+		Header("Content-Language", "ru")
+	client.GET("/hello/bee").WithHeader("Cookie", "lang=ru").WithQuery("lang", "zh").Do().
+		Header("Content-Language", "zh-CN")
+
+	client.GET("/page/bee").WithQuery("lang", "zh").Do().BodyEquals("你好，bee！ 首页")
+	client.GET("/page/bee").Do().BodyEquals("Hello, bee! Home")
+}
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML([]byte("a.\"b.c\" = \"x\\ty\" # comment\n[d]\ne = 'z'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"b.c": "x\ty"},
+		"d": map[string]interface{}{"e": "z"},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("unexpected document %v", doc)
+	}
+	for _, bad := range []string{"a = 1", "a = \"x", "[a", "a.b = \"x\"\na = \"y\"\na.c = \"z\""} {
+		if _, err := parseTOML([]byte(bad)); err == nil {
+			t.Errorf("expect an error for %q", bad)
+		}
+	}
+}
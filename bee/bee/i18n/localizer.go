@@ -0,0 +1,182 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Localizer translates the messages of a locale, it implements bee.Translator
+type Localizer struct {
+	bundle *Bundle
+	locale string
+}
+
+// Locale returns the locale of the localizer
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T translates the key, args are a map[string]interface{} or key value pairs, eg. T("apples", "count", 3).
+// {name} in the message is replaced by the arg name, the arg count selects the plural form.
+// The key itself is returned when no catalog has it.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	message, locale, ok := l.bundle.lookup(l.locale, key)
+	if !ok {
+		return key
+	}
+	params := toParams(args)
+	text := message.Other
+	if count, ok := params["count"]; ok {
+		if n, ok := toFloat(count); ok {
+			text = message.form(pluralCategory(baseLanguage(locale), n))
+		}
+	}
+	return interpolate(text, params)
+}
+
+func toParams(args []interface{}) map[string]interface{} {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]interface{}); ok {
+			return m
+		}
+	}
+	params := make(map[string]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		params[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return params
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// interpolate replaces {name} by the params, unknown placeholders are kept
+func interpolate(text string, params map[string]interface{}) string {
+	if len(params) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(text[:start])
+		if value, ok := params[text[start+1:end]]; ok {
+			sb.WriteString(fmt.Sprint(value))
+		} else {
+			sb.WriteString(text[start : end+1])
+		}
+		text = text[end+1:]
+	}
+	sb.WriteString(text)
+	return sb.String()
+}
+
+// pluralCategory returns the CLDR plural category of n for the language, only integers get one/few/many
+func pluralCategory(lang string, n float64) string {
+	n = math.Abs(n)
+	integer := n == math.Trunc(n)
+	i := int64(n)
+	switch lang {
+	case "zh", "ja", "ko", "vi", "th", "id", "ms":
+		return "other"
+	case "fr", "pt":
+		if n < 2 {
+			return "one"
+		}
+		return "other"
+	case "ru", "uk", "be", "sr", "hr", "bs":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i%10 == 1 && i%100 != 11:
+			return "one"
+		case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+			return "few"
+		}
+		return "many"
+	case "pl":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i == 1:
+			return "one"
+		case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+			return "few"
+		}
+		return "many"
+	case "cs", "sk":
+		if !integer {
+			return "many"
+		}
+		switch {
+		case i == 1:
+			return "one"
+		case i >= 2 && i <= 4:
+			return "few"
+		}
+		return "other"
+	case "ar":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i == 0:
+			return "zero"
+		case i == 1:
+			return "one"
+		case i == 2:
+			return "two"
+		case i%100 >= 3 && i%100 <= 10:
+			return "few"
+		case i%100 >= 11:
+			return "many"
+		}
+		return "other"
+	}
+	// en, de, es, it...
+	if integer && i == 1 {
+		return "one"
+	}
+	return "other"
+}
@@ -0,0 +1,77 @@
+package i18n
+
+import (
+	"bee"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options tell where the locale of a request is read
+type Options struct {
+	// QueryParam names the query parameter choosing the locale, eg. ?lang=zh-CN; disabled if empty
+	QueryParam string
+	// CookieName names the cookie choosing the locale; disabled if empty
+	CookieName string
+}
+
+// DefaultOptions reads the locale from ?lang= and the lang cookie
+var DefaultOptions = Options{QueryParam: "lang", CookieName: "lang"}
+
+// Middleware sets the translator of the request, the locale is chosen from the query parameter,
+// then the cookie, then Accept-Language, falling back to the default locale of the bundle.
+func Middleware(bundle *Bundle, opts Options) bee.HandlerFunc {
+	return func(c *bee.Context) {
+		var candidates []string
+		if opts.QueryParam != "" {
+			if lang := c.Query(opts.QueryParam); lang != "" {
+				candidates = append(candidates, lang)
+			}
+		}
+		if opts.CookieName != "" {
+			if cookie, err := c.Req.Cookie(opts.CookieName); err == nil && cookie.Value != "" {
+				candidates = append(candidates, cookie.Value)
+			}
+		}
+		candidates = append(candidates, ParseAcceptLanguage(c.Req.Header.Get("Accept-Language"))...)
+		localizer := bundle.Localizer(bundle.Match(candidates...))
+		c.SetTranslator(localizer)
+		c.SetHeader("Content-Language", localizer.Locale())
+		c.Next()
+	}
+}
+
+// ParseAcceptLanguage returns the languages of the header by decreasing quality, * and q=0 are skipped
+func ParseAcceptLanguage(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q > 0 {
+			languages = append(languages, language{tag, q})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
@@ -0,0 +1,137 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by catalogs: [tables], dotted or quoted keys,
+// basic and literal strings and comments. Other values are rejected.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	table := doc
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		if text[0] == '[' {
+			end := strings.LastIndexByte(text, ']')
+			if end < 0 || strings.HasPrefix(text, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header", line)
+			}
+			keys, rest, err := parseKeys(text[1:end], "")
+			if err != nil || strings.TrimSpace(rest) != "" || !isComment(text[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header", line)
+			}
+			if table, err = subTable(doc, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			continue
+		}
+		keys, rest, err := parseKeys(text, "=")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		value, rest, err := parseString(strings.TrimSpace(strings.TrimPrefix(rest, "=")))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if !isComment(rest) {
+			return nil, fmt.Errorf("line %d: unexpected %q", line, rest)
+		}
+		parent, err := subTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		parent[keys[len(keys)-1]] = value
+	}
+	return doc, scanner.Err()
+}
+
+// parseKeys parses a dotted key until stop, rest starts at stop
+func parseKeys(s, stop string) ([]string, string, error) {
+	var keys []string
+	for {
+		s = strings.TrimSpace(s)
+		var key string
+		var err error
+		if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+			key, s, err = parseString(s)
+			if err != nil {
+				return nil, "", err
+			}
+		} else {
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, "", fmt.Errorf("missing key")
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, ".") {
+			break
+		}
+		s = s[1:]
+	}
+	if stop != "" && !strings.HasPrefix(s, stop) {
+		return nil, "", fmt.Errorf("expect %q after key", stop)
+	}
+	return keys, s, nil
+}
+
+// parseString parses a basic "..." or literal '...' string at the beginning of s
+func parseString(s string) (string, string, error) {
+	if strings.HasPrefix(s, "'") {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("value must be a string")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// subTable returns the table at keys, creating the missing ones
+func subTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			sub := make(map[string]interface{})
+			table[key] = sub
+			table = sub
+		case map[string]interface{}:
+			table = v
+		default:
+			return nil, fmt.Errorf("key %s is already a string", key)
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"bee"
+	"crypto/subtle"
+	"net/http"
+)
+
+// BasicAuth authorizes the requests carrying one of the user/password pairs of accounts
+func BasicAuth(realm string, accounts map[string]string) bee.HandlerFunc {
+	return func(c *bee.Context) {
+		user, password, ok := c.Req.BasicAuth()
+		expected, known := accounts[user]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+			c.SetHeader("WWW-Authenticate", `Basic realm="`+realm+`"`)
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,300 @@
+// Package capture records requests and responses of bee handlers into a ring buffer for debugging,
+// the recordings can be exported as HAR 1.2 and replayed against an Engine.
+package capture
+
+import (
+	"bee"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSize         = 100
+	defaultMaxBodyBytes = 64 << 10
+	// Redacted replaces the values of the redacted headers and query parameters
+	Redacted = "[REDACTED]"
+)
+
+// DefaultRedactHeaders are the headers carrying credentials
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// DefaultRedactQuery are the query parameters carrying credentials
+var DefaultRedactQuery = []string{"token", "access_token", "refresh_token", "api_key", "apikey", "key",
+	"password", "secret", "signature", "sig", "code"}
+
+// Options bound what is recorded
+type Options struct {
+	// Size is the number of recordings kept, the oldest ones are dropped, 100 by default
+	Size int
+	// MaxBodyBytes caps the recorded bodies, the rest is dropped but still reaches the handler or the client.
+	// 64KB by default, a negative value records no body.
+	MaxBodyBytes int
+	// RedactHeaders are the headers whose values are replaced by Redacted, DefaultRedactHeaders if nil
+	RedactHeaders []string
+	// RedactQuery are the query parameters whose values are replaced by Redacted, the case is ignored.
+	// DefaultRedactQuery if nil.
+	RedactQuery []string
+	// Skip tells which requests aren't recorded, eg. the ones of the recordings routes
+	Skip func(c *bee.Context) bool
+}
+
+// Entry is a recorded exchange
+type Entry struct {
+	ID                uint64        `json:"id"`
+	Started           time.Time     `json:"started"`
+	Duration          time.Duration `json:"duration"`
+	ClientIP          string        `json:"clientIP"`
+	Method            string        `json:"method"`
+	URL               string        `json:"url"`
+	Proto             string        `json:"proto"`
+	Pattern           string        `json:"pattern"`
+	RequestHeader     http.Header   `json:"requestHeader"`
+	RequestBody       []byte        `json:"-"`
+	RequestSize       int64         `json:"requestSize"` // -1 if unknown
+	RequestTruncated  bool          `json:"requestTruncated"`
+	Status            int           `json:"status"`
+	ResponseHeader    http.Header   `json:"responseHeader"`
+	ResponseBody      []byte        `json:"-"`
+	ResponseSize      int64         `json:"responseSize"`
+	ResponseTruncated bool          `json:"responseTruncated"`
+}
+
+// Recorder keeps the last recordings
+type Recorder struct {
+	opts    Options
+	redact  map[string]bool
+	query   map[string]bool // the redacted query parameters, lower case
+	mu      sync.Mutex      // protect following
+	entries []*Entry        // ring buffer, next is the slot of the next recording
+	next    int
+	seq     uint64
+}
+
+// New creates a Recorder
+func New(opts Options) *Recorder {
+	if opts.Size <= 0 {
+		opts.Size = defaultSize
+	}
+	if opts.MaxBodyBytes == 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	if opts.RedactQuery == nil {
+		opts.RedactQuery = DefaultRedactQuery
+	}
+	r := &Recorder{
+		opts:    opts,
+		redact:  make(map[string]bool, len(opts.RedactHeaders)),
+		query:   make(map[string]bool, len(opts.RedactQuery)),
+		entries: make([]*Entry, opts.Size),
+	}
+	for _, name := range opts.RedactHeaders {
+		r.redact[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range opts.RedactQuery {
+		r.query[strings.ToLower(name)] = true
+	}
+	return r
+}
+
+// Middleware records the requests going through it with the responses of the following handlers
+func (r *Recorder) Middleware() bee.HandlerFunc {
+	return func(c *bee.Context) {
+		if r.opts.Skip != nil && r.opts.Skip(c) {
+			c.Next()
+			return
+		}
+		e := &Entry{
+			Started:       time.Now(),
+			ClientIP:      c.ClientIP(),
+			Method:        c.Method,
+			URL:           c.Scheme() + "://" + c.Host() + r.redactURI(c.Req.URL),
+			Proto:         c.Req.Proto,
+			RequestHeader: r.redactHeader(c.Req.Header),
+			RequestSize:   c.Req.ContentLength,
+		}
+		if c.Req.Body != nil && c.Req.Body != http.NoBody && r.opts.MaxBodyBytes > 0 {
+			e.RequestBody, e.RequestTruncated = r.peekBody(c.Req)
+			if !e.RequestTruncated {
+				e.RequestSize = int64(len(e.RequestBody))
+			}
+		}
+
+		writer := c.Writer
+		w := &responseWriter{ResponseWriter: writer, max: r.opts.MaxBodyBytes}
+		c.Writer = w
+		defer func() {
+			c.Writer = writer
+			e.Duration = time.Since(e.Started)
+			e.Pattern = c.Pattern
+			e.Status = w.status
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			e.ResponseHeader = r.redactHeader(writer.Header())
+			e.ResponseBody = w.body.Bytes()
+			e.ResponseSize = w.size
+			e.ResponseTruncated = w.size > int64(w.body.Len())
+			r.add(e)
+		}()
+		c.Next()
+	}
+}
+
+// peekBody reads the beginning of the body and puts it back in front of the rest
+func (r *Recorder) peekBody(req *http.Request) ([]byte, bool) {
+	limit := int64(r.opts.MaxBodyBytes)
+	head, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	req.Body = &body{Reader: io.MultiReader(bytes.NewReader(head), req.Body), Closer: req.Body}
+	if err != nil {
+		return head, true
+	}
+	if int64(len(head)) > limit {
+		return head[:limit], true
+	}
+	return head, false
+}
+
+type body struct {
+	io.Reader
+	io.Closer
+}
+
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for name, values := range h {
+		if r.redact[name] {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return h
+}
+
+// redactURI returns the request uri with the values of the redacted query parameters replaced
+func (r *Recorder) redactURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	redacted := false
+	for name, values := range query {
+		if r.query[strings.ToLower(name)] {
+			for i := range values {
+				values[i] = Redacted
+			}
+			redacted = true
+		}
+	}
+	if err != nil {
+		// 无法解析的查询串可能藏着凭证，整个替换掉
+		query, redacted = url.Values{"query": {Redacted}}, true
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	c := *u
+	c.RawQuery = query.Encode()
+	return c.RequestURI()
+}
+
+func (r *Recorder) add(e *Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	e.ID = r.seq
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+}
+
+// Entries returns the recordings, oldest first
+func (r *Recorder) Entries() []*Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]*Entry, 0, len(r.entries))
+	for i := 0; i < len(r.entries); i++ {
+		if e := r.entries[(r.next+i)%len(r.entries)]; e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Clear drops all the recordings
+func (r *Recorder) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.entries {
+		r.entries[i] = nil
+	}
+	r.next = 0
+}
+
+// Register exposes the recordings on the group:
+// GET /captures lists them, GET /captures/har downloads them as HAR and POST /captures/clear drops them.
+// Recordings contain request bodies, so the guard(eg. middlewares.BasicAuth) is required.
+// It's chained to each route rather than used by the group, so no path can skip it.
+func (r *Recorder) Register(g *bee.RouterGroup, guard bee.HandlerFunc) {
+	if guard == nil {
+		panic("capture: recordings must be protected by a guard")
+	}
+	g.GET("/captures", bee.Chain(guard, func(c *bee.Context) {
+		c.SetHeader("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, r.Entries())
+	})).Summary("list the recorded requests").Tags("debug")
+	g.GET("/captures/har", bee.Chain(guard, func(c *bee.Context) {
+		c.SetHeader("Cache-Control", "no-store")
+		c.SetHeader("Content-Disposition", `attachment; filename="captures.har"`)
+		c.JSON(http.StatusOK, r.HAR())
+	})).Summary("download the recorded requests as HAR 1.2").Tags("debug")
+	g.POST("/captures/clear", bee.Chain(guard, func(c *bee.Context) {
+		r.Clear()
+		c.Status(http.StatusNoContent)
+	})).Summary("drop the recorded requests").Tags("debug")
+}
+
+// responseWriter passes the response through and keeps the beginning of the body
+type responseWriter struct {
+	http.ResponseWriter
+	max    int
+	status int
+	size   int64
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if room := w.max - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(room, len(b))])
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,127 @@
+package capture
+
+import (
+	"bee"
+	"bee/beetest"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestEngine(rec *Recorder) *bee.Engine {
+	r := bee.New()
+	r.Use(rec.Middleware())
+	r.POST("/echo", func(c *bee.Context) {
+		body, _ := io.ReadAll(c.Req.Body)
+		c.SetHeader("Set-Cookie", "session=secret")
+		c.Data(http.StatusCreated, body)
+	})
+	r.GET("/hello", func(c *bee.Context) {
+		c.String(http.StatusOK, "hello %s", c.Query("name"))
+	})
+	return r
+}
+
+func TestRecorder(t *testing.T) {
+	rec := New(Options{Size: 2, MaxBodyBytes: 4})
+	client := beetest.New(t, newTestEngine(rec))
+
+	client.GET("/hello").WithQuery("name", "bee").Do().BodyEquals("hello bee")
+	client.POST("/echo").WithHeader("Authorization", "Bearer t").WithBody("text/plain", []byte("0123456789")).Do().
+		Status(http.StatusCreated).BodyEquals("0123456789")
+	client.GET("/hello").WithQuery("name", "again").Do()
+
+	entries := rec.Entries()
+	if len(entries) != 2 || entries[0].ID != 2 || entries[1].ID != 3 {
+		t.Fatalf("expect the 2 last recordings, got %+v", entries)
+	}
+	e := entries[0]
+	if string(e.RequestBody) != "0123" || !e.RequestTruncated || string(e.ResponseBody) != "0123" ||
+		!e.ResponseTruncated || e.ResponseSize != 10 || e.Status != http.StatusCreated || e.Pattern != "/echo" {
+		t.Fatalf("unexpected recording %+v", e)
+	}
+	if e.RequestHeader.Get("Authorization") != Redacted || e.ResponseHeader.Get("Set-Cookie") != Redacted {
+		t.Fatalf("headers aren't redacted %v %v", e.RequestHeader, e.ResponseHeader)
+	}
+	if entries[1].URL != "http://example.com/hello?name=again" {
+		t.Fatalf("unexpected url %s", entries[1].URL)
+	}
+
+	client.GET("/hello").WithQuery("name", "bee").WithQuery("Access_Token", "t0p").WithQuery("sig", "abc").Do()
+	e = rec.Entries()[1]
+	if e.URL != "http://example.com/hello?Access_Token=%5BREDACTED%5D&name=bee&sig=%5BREDACTED%5D" {
+		t.Fatalf("query isn't redacted %s", e.URL)
+	}
+	if har := rec.HAR(); strings.Contains(fmt.Sprint(har), "t0p") {
+		t.Fatal("the HAR shouldn't contain the token")
+	}
+}
+
+func TestHARReplay(t *testing.T) {
+	rec := New(Options{})
+	client := beetest.New(t, newTestEngine(rec))
+	client.GET("/hello").WithQuery("name", "bee").Do()
+	client.POST("/echo").WithHeader("Authorization", "Bearer t").WithBody("application/octet-stream", []byte{0xff, 0x00}).Do()
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(rec.HAR()); err != nil {
+		t.Fatal(err)
+	}
+	har, err := ReadHAR(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("unexpected har %+v", har.Log)
+	}
+	get, post := har.Log.Entries[0], har.Log.Entries[1]
+	if len(get.Request.QueryString) != 1 || get.Request.QueryString[0].Value != "bee" || get.Response.Content.Text != "hello bee" {
+		t.Fatalf("unexpected entry %+v", get)
+	}
+	if post.Request.PostData == nil || post.Request.PostData.Comment != base64Comment ||
+		post.Response.Content.Encoding != "base64" || len(post.Response.Cookies) != 0 {
+		t.Fatalf("unexpected entry %+v", post)
+	}
+
+	recorders, err := Replay(newTestEngine(New(Options{})), har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beetest.Record(t, recorders[0]).Status(http.StatusOK).BodyEquals("hello bee")
+	beetest.Record(t, recorders[1]).Status(http.StatusCreated).BodyEquals(string([]byte{0xff, 0x00}))
+}
+
+func TestRegister(t *testing.T) {
+	rec := New(Options{Skip: func(c *bee.Context) bool {
+		return strings.HasPrefix(c.Path, "/debug/")
+	}})
+	r := newTestEngine(rec)
+	debug := r.Group("/debug")
+	rec.Register(debug, func(c *bee.Context) {
+		if c.Req.Header.Get("X-Debug") != "1" {
+			c.Fail(http.StatusForbidden, "forbidden")
+			return
+		}
+		c.Next()
+	})
+	client := beetest.New(t, r)
+	client.GET("/hello").Do()
+
+	client.GET("/debug/captures").Do().Status(http.StatusForbidden)
+	// the empty segments are ignored by the router, they must not skip the guard
+	client.GET("//debug/captures").Do().Status(http.StatusForbidden)
+	client.GET("//debug/captures/har").Do().Status(http.StatusForbidden)
+	client.POST("/debug//captures/clear").Do().Status(http.StatusForbidden)
+	client.GET("/debug/captures").WithHeader("X-Debug", "1").Do().
+		Status(http.StatusOK).JSON("0.method", "GET").JSON("0.status", 200)
+	client.GET("/debug/captures/har").WithHeader("X-Debug", "1").Do().
+		Status(http.StatusOK).JSON("log.version", "1.2").JSON("log.entries.0.request.method", "GET")
+	client.POST("/debug/captures/clear").WithHeader("X-Debug", "1").Do().Status(http.StatusNoContent)
+	if n := len(rec.Entries()); n != 0 {
+		t.Fatalf("expect no recording, got %d", n)
+	}
+}
@@ -0,0 +1,273 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is a HTTP Archive 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData holds the request body, binary bodies are base64 encoded and flagged by the comment
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+const (
+	base64Comment    = "base64"
+	truncatedComment = "body truncated"
+)
+
+// HAR exports the recordings, oldest first
+func (r *Recorder) HAR() *HAR {
+	entries := r.Entries()
+	har := &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "bee capture", Version: "1.0"},
+		Entries: make([]HAREntry, 0, len(entries)),
+	}}
+	for _, e := range entries {
+		har.Log.Entries = append(har.Log.Entries, e.HAR())
+	}
+	return har
+}
+
+// HAR converts the entry, the redacted cookies are left out
+func (e *Entry) HAR() HAREntry {
+	ms := float64(e.Duration) / float64(time.Millisecond)
+	entry := HAREntry{
+		StartedDateTime: e.Started.Format(time.RFC3339Nano),
+		Time:            ms,
+		Timings:         HARTimings{Wait: ms},
+		Request: HARRequest{
+			Method:      e.Method,
+			URL:         e.URL,
+			HTTPVersion: e.Proto,
+			Cookies:     requestCookies(e.RequestHeader),
+			Headers:     nameValues(e.RequestHeader),
+			QueryString: []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    e.RequestSize,
+		},
+		Response: HARResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: e.Proto,
+			Cookies:     responseCookies(e.ResponseHeader),
+			Headers:     nameValues(e.ResponseHeader),
+			Content: HARContent{
+				Size:     e.ResponseSize,
+				MimeType: e.ResponseHeader.Get("Content-Type"),
+			},
+			RedirectURL: e.ResponseHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    e.ResponseSize,
+		},
+	}
+	if u, err := url.Parse(e.URL); err == nil {
+		entry.Request.QueryString = valuesList(u.Query())
+	}
+	if len(e.RequestBody) > 0 || e.RequestTruncated {
+		text, binary := encodeBody(e.RequestBody)
+		entry.Request.PostData = &HARPostData{MimeType: e.RequestHeader.Get("Content-Type"), Text: text}
+		if binary {
+			entry.Request.PostData.Comment = base64Comment
+		}
+		if e.RequestTruncated {
+			entry.Request.Comment = truncatedComment
+		}
+	}
+	if len(e.ResponseBody) > 0 {
+		text, binary := encodeBody(e.ResponseBody)
+		entry.Response.Content.Text = text
+		if binary {
+			entry.Response.Content.Encoding = "base64"
+		}
+	}
+	if e.ResponseTruncated {
+		entry.Response.Content.Comment = truncatedComment
+	}
+	return entry
+}
+
+func encodeBody(b []byte) (string, bool) {
+	if utf8.Valid(b) {
+		return string(b), false
+	}
+	return base64.StdEncoding.EncodeToString(b), true
+}
+
+func nameValues(header http.Header) []HARNameValue {
+	list := []HARNameValue{}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			list = append(list, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+func valuesList(values url.Values) []HARNameValue {
+	return nameValues(http.Header(values))
+}
+
+func requestCookies(header http.Header) []HARCookie {
+	cookies := []HARCookie{}
+	if header.Get("Cookie") == Redacted {
+		return cookies
+	}
+	for _, cookie := range (&http.Request{Header: header}).Cookies() {
+		cookies = append(cookies, HARCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+func responseCookies(header http.Header) []HARCookie {
+	cookies := []HARCookie{}
+	if header.Get("Set-Cookie") == Redacted {
+		return cookies
+	}
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		cookies = append(cookies, HARCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+// ReadHAR decodes a HAR document
+func ReadHAR(r io.Reader) (*HAR, error) {
+	har := &HAR{}
+	if err := json.NewDecoder(r).Decode(har); err != nil {
+		return nil, err
+	}
+	return har, nil
+}
+
+// NewRequest rebuilds the recorded request, the redacted headers are left out
+func (e HAREntry) NewRequest() (*http.Request, error) {
+	var body io.Reader
+	if data := e.Request.PostData; data != nil {
+		b := []byte(data.Text)
+		if data.Comment == base64Comment {
+			var err error
+			if b, err = base64.StdEncoding.DecodeString(data.Text); err != nil {
+				return nil, fmt.Errorf("capture: decode body of %s %s: %v", e.Request.Method, e.Request.URL, err)
+			}
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(e.Request.Method, e.Request.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range e.Request.Headers {
+		if h.Value != Redacted {
+			req.Header.Add(h.Name, h.Value)
+		}
+	}
+	return req, nil
+}
+
+// Replay sends the requests of the archive to the handler(eg. a local bee.Engine), in order
+func Replay(handler http.Handler, har *HAR) ([]*httptest.ResponseRecorder, error) {
+	recorders := make([]*httptest.ResponseRecorder, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		req, err := e.NewRequest()
+		if err != nil {
+			return recorders, err
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		recorders = append(recorders, rec)
+	}
+	return recorders, nil
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"bee"
+	"crypto/x509/pkix"
+	"net/http"
+)
+
+// ClientCert authorizes the requests by the subject of the verified client certificate.
+// Requests without a verified certificate get 401, those rejected by authorize get 403.
+func ClientCert(authorize func(subject pkix.Name) bool) bee.HandlerFunc {
+	return func(c *bee.Context) {
+		subject, ok := c.ClientCertSubject()
+		if !ok {
+			c.Fail(http.StatusUnauthorized, "client certificate required")
+			return
+		}
+		if !authorize(subject) {
+			c.Fail(http.StatusForbidden, "client certificate not allowed")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AllowCommonNames authorizes the subjects whose common name is one of names
+func AllowCommonNames(names ...string) func(subject pkix.Name) bool {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return func(subject pkix.Name) bool {
+		return allowed[subject.CommonName]
+	}
+}
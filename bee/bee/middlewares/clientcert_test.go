@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"bee"
+	"bee/beetest"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCert(t *testing.T) {
+	handlers := []bee.HandlerFunc{
+		ClientCert(AllowCommonNames("billing", "reports")),
+		func(c *bee.Context) {
+			c.String(http.StatusOK, "hello %s", c.Req.TLS.VerifiedChains[0][0].Subject.CommonName)
+		},
+	}
+	request := func(cn string) *beetest.Response {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cn != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		c, rec := beetest.NewContext(req, handlers...)
+		c.Next()
+		return beetest.Record(t, rec)
+	}
+
+	request("billing").Status(http.StatusOK).BodyEquals("hello billing")
+	request("reports").Status(http.StatusOK)
+	request("intruder").Status(http.StatusForbidden)
+	request("").Status(http.StatusUnauthorized)
+
+	// a certificate presented but not verified doesn't count
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "billing"}}}}
+	c, rec := beetest.NewContext(req, handlers...)
+	c.Next()
+	beetest.Record(t, rec).Status(http.StatusUnauthorized)
+}
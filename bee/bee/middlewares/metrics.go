@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"bee"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram buckets
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels the requests which match no route
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels the requests of a non standard method, the client chooses it so it can't be a label
+const otherMethod = "OTHER"
+
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+type requestLabels struct {
+	method string
+	route  string
+	status string
+}
+
+type histogram struct {
+	counts []uint64 // counts[i] counts the observations <= buckets[i], not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects request counts, latencies and in-flight requests.
+// They are labelled by method, the pattern of the matched route and status code.
+type Metrics struct {
+	buckets   []float64
+	mu        sync.Mutex // protect following
+	requests  map[requestLabels]uint64
+	durations map[requestLabels]*histogram
+	inFlight  map[requestLabels]int64 // status is always empty
+}
+
+// NewMetrics creates a Metrics with the latency buckets, DefaultBuckets are used if none is given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Metrics{
+		buckets:   sorted,
+		requests:  make(map[requestLabels]uint64),
+		durations: make(map[requestLabels]*histogram),
+		inFlight:  make(map[requestLabels]int64),
+	}
+}
+
+// Middleware records the requests going through it
+func (m *Metrics) Middleware() bee.HandlerFunc {
+	return func(c *bee.Context) {
+		start := time.Now()
+		route := c.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Method
+		if !standardMethods[method] {
+			method = otherMethod
+		}
+		flight := requestLabels{method: method, route: route}
+		m.mu.Lock()
+		m.inFlight[flight]++
+		m.mu.Unlock()
+		defer func() {
+			status := c.StatusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			m.observe(flight, status, time.Since(start))
+		}()
+		c.Next()
+	}
+}
+
+func (m *Metrics) observe(flight requestLabels, status int, elapsed time.Duration) {
+	labels := flight
+	labels.status = strconv.Itoa(status)
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[flight]--
+	m.requests[labels]++
+	h, ok := m.durations[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[labels] = h
+	}
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Handler serves the metrics in the Prometheus text exposition format
+func (m *Metrics) Handler() bee.HandlerFunc {
+	return func(c *bee.Context) {
+		c.SetHeader("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Data(http.StatusOK, []byte(m.Text()))
+	}
+}
+
+// Text returns the metrics in the Prometheus text exposition format
+func (m *Metrics) Text() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sb strings.Builder
+
+	sb.WriteString("# HELP bee_http_requests_total Total number of HTTP requests.\n")
+	sb.WriteString("# TYPE bee_http_requests_total counter\n")
+	for _, labels := range sortedLabels(m.requests) {
+		fmt.Fprintf(&sb, "bee_http_requests_total%s %d\n", labels.format(""), m.requests[labels])
+	}
+
+	sb.WriteString("# HELP bee_http_request_duration_seconds Latency of HTTP requests in seconds.\n")
+	sb.WriteString("# TYPE bee_http_request_duration_seconds histogram\n")
+	for _, labels := range sortedLabels(m.durations) {
+		h := m.durations[labels]
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += h.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(&sb, "bee_http_request_duration_seconds_bucket%s %d\n", labels.format(le), cumulative)
+		}
+		fmt.Fprintf(&sb, "bee_http_request_duration_seconds_bucket%s %d\n", labels.format("+Inf"), h.count)
+		fmt.Fprintf(&sb, "bee_http_request_duration_seconds_sum%s %s\n", labels.format(""), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&sb, "bee_http_request_duration_seconds_count%s %d\n", labels.format(""), h.count)
+	}
+
+	sb.WriteString("# HELP bee_http_requests_in_flight Number of HTTP requests being served.\n")
+	sb.WriteString("# TYPE bee_http_requests_in_flight gauge\n")
+	for _, labels := range sortedLabels(m.inFlight) {
+		fmt.Fprintf(&sb, "bee_http_requests_in_flight%s %d\n", labels.format(""), m.inFlight[labels])
+	}
+	return sb.String()
+}
+
+// format renders the label set, le is added for histogram buckets if not empty
+func (l requestLabels) format(le string) string {
+	pairs := []string{`method="` + escapeLabel(l.method) + `"`, `route="` + escapeLabel(l.route) + `"`}
+	if l.status != "" {
+		pairs = append(pairs, `status="`+l.status+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func sortedLabels[V any](m map[requestLabels]V) []requestLabels {
+	keys := make([]requestLabels, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	return keys
+}
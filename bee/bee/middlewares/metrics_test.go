@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"bee"
+	"bee/beetest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(0.1, 1)
+	r := bee.New()
+	r.Use(m.Middleware())
+	r.GET("/users/:id", func(c *bee.Context) {
+		c.String(http.StatusOK, "user %s", c.Param("id"))
+	})
+	r.GET("/metrics", m.Handler())
+
+	client := beetest.New(t, r)
+	client.GET("/users/1").Do().Status(http.StatusOK)
+	client.GET("/users/2").Do().Status(http.StatusOK)
+	client.GET("/nowhere").Do().Status(http.StatusNotFound)
+	client.Request("FOO", "/nowhere").Do()
+	client.Request("BAR", "/nowhere").Do()
+
+	resp := client.GET("/metrics").Do().Status(http.StatusOK)
+	for _, want := range []string{
+		`bee_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`bee_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`bee_http_requests_total{method="OTHER",route="unmatched",status="404"} 2`,
+		`bee_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="200",le="+Inf"} 2`,
+		`bee_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2`,
+		`bee_http_requests_in_flight{method="GET",route="/users/:id"} 0`,
+		`bee_http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		"# TYPE bee_http_request_duration_seconds histogram",
+	} {
+		resp.BodyContains(want)
+	}
+	if strings.Contains(resp.Body.String(), "/users/1") {
+		t.Fatal("raw path should not be used as label")
+	}
+	if strings.Contains(resp.Body.String(), "FOO") {
+		t.Fatal("a non standard method should not be used as label")
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Fatalf("unexpected escaped label %s", got)
+	}
+}
@@ -0,0 +1,405 @@
+// Package respcache caches whole responses of bee handlers in a beeCache.Group.
+package respcache
+
+import (
+	"bee"
+	"beeCache"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options decide which responses are cached and how the key is built
+type Options struct {
+	// QueryParams are the query parameters taking part in the key, the others are ignored
+	QueryParams []string
+	// VaryHeaders are the request headers taking part in the key
+	VaryHeaders []string
+	// DefaultTTL is used when the response doesn't carry max-age, responses without max-age aren't cached if it's 0
+	DefaultTTL time.Duration
+	// MaxKeys bounds the keys whose version is tracked, 10000 by default.
+	// A forgotten key only loses its cached response.
+	MaxKeys int
+}
+
+const defaultMaxKeys = 10000
+
+// Cache is a response cache middleware.
+// Keys look like "GET /path?query|header values", they're versioned internally so that
+// stale or invalidated entries are never read again, even by a request already holding them.
+type Cache struct {
+	group    *beeCache.Group
+	opts     Options
+	now      func() time.Time
+	mu       sync.Mutex // protect following
+	versions map[string]uint64
+	next     uint64 // the last version given, they're never reused
+	pending  map[string]*render
+}
+
+// entry is a cached response
+type entry struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	ETag    string
+	Created time.Time
+	Expires time.Time
+}
+
+// render is a response being produced by the request owning it
+type render struct {
+	c     *bee.Context
+	entry *entry
+}
+
+var errNotCacheable = errors.New("respcache: response is not cacheable")
+
+// New creates a Cache backed by a new beeCache.Group of cacheBytes
+func New(name string, cacheBytes int64, opts Options) *Cache {
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = defaultMaxKeys
+	}
+	rc := &Cache{
+		opts:     opts,
+		now:      time.Now,
+		versions: make(map[string]uint64),
+		// 从当前时间开始编号，重启后不会读到之前缓存的响应
+		next:    uint64(time.Now().UnixNano()),
+		pending: make(map[string]*render),
+	}
+	rc.group = beeCache.NewGroup(name, cacheBytes, beeCache.GetterFunc(rc.load))
+	return rc
+}
+
+// Group returns the group holding the responses. They're rendered by the request asking them,
+// so the group must not be registered with peers: a peer asking a key gets an error.
+func (rc *Cache) Group() *beeCache.Group {
+	return rc.group
+}
+
+// Middleware serves GET requests from the cache and caches the responses of the following handlers
+func (rc *Cache) Middleware() bee.HandlerFunc {
+	return func(c *bee.Context) {
+		reqCC := parseCacheControl(c.Req.Header.Get("Cache-Control"))
+		if c.Method != http.MethodGet || reqCC.has("no-store") || c.Req.Header.Get("Authorization") != "" {
+			c.Next()
+			return
+		}
+		key := rc.Key(c)
+		if reqCC.has("no-cache") || reqCC.maxAge() == 0 {
+			rc.forget(key)
+		}
+		for retry := 0; retry < 2; retry++ {
+			if rc.serveOrRender(c, key) {
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// serveOrRender serves the cached response of key or renders it, it returns false if the cached one expired
+func (rc *Cache) serveOrRender(c *bee.Context, key string) bool {
+	vkey, r, owner := rc.acquire(key, c)
+	if !owner {
+		// the same key is being rendered by another request, don't wait for it
+		c.Next()
+		return true
+	}
+	// a panicking handler must not leave the key rendering forever
+	defer rc.release(vkey)
+	// the handlers are rendered by the load, it must not be abandoned while they write the response
+	view, err := rc.group.GetContext(context.WithoutCancel(c.Req.Context()), vkey)
+	if r.entry != nil {
+		// rendered by this request, cached or not
+		rc.serve(c, r.entry, "MISS")
+		return true
+	}
+	if err != nil {
+		c.Next()
+		return true
+	}
+	e, err := decode(view.ByteSlice())
+	if err != nil || !rc.now().Before(e.Expires) {
+		rc.forget(key)
+		return false
+	}
+	rc.serve(c, e, "HIT")
+	return true
+}
+
+// Key builds the cache key of the request from method, path, selected query params and vary headers
+func (rc *Cache) Key(c *bee.Context) string {
+	var sb strings.Builder
+	sb.WriteString(c.Method + " " + c.Path)
+	query := c.Req.URL.Query()
+	selected := make(url.Values)
+	for _, name := range rc.opts.QueryParams {
+		if values, ok := query[name]; ok {
+			selected[name] = values
+		}
+	}
+	if len(selected) > 0 {
+		sb.WriteString("?" + selected.Encode())
+	}
+	for _, name := range rc.opts.VaryHeaders {
+		sb.WriteString("|" + strings.Join(c.Req.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// Invalidate drops the cached responses whose key starts with prefix, eg "GET /users/"
+func (rc *Cache) Invalidate(prefix string) int {
+	rc.mu.Lock()
+	var stale []string
+	for key, version := range rc.versions {
+		if strings.HasPrefix(key, prefix) {
+			stale = append(stale, versioned(key, version))
+			delete(rc.versions, key)
+		}
+	}
+	rc.mu.Unlock()
+	rc.drop(stale...)
+	return len(stale)
+}
+
+// acquire registers the request as the renderer of the current version of key
+func (rc *Cache) acquire(key string, c *bee.Context) (string, *render, bool) {
+	rc.mu.Lock()
+	var stale []string
+	version, ok := rc.versions[key]
+	if !ok {
+		// 超过上限时随机忘记一些key，它们下次会拿到新的版本
+		for forgotten, v := range rc.versions {
+			if len(rc.versions) < rc.opts.MaxKeys {
+				break
+			}
+			stale = append(stale, versioned(forgotten, v))
+			delete(rc.versions, forgotten)
+		}
+		rc.next++
+		version = rc.next
+		rc.versions[key] = version
+	}
+	vkey := versioned(key, version)
+	r, busy := rc.pending[vkey]
+	if !busy {
+		r = &render{c: c}
+		rc.pending[vkey] = r
+	}
+	rc.mu.Unlock()
+	rc.drop(stale...)
+	if busy {
+		return vkey, nil, false
+	}
+	return vkey, r, true
+}
+
+func (rc *Cache) release(vkey string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.pending, vkey)
+}
+
+// forget drops the version of key, the next request gets a new one so the cached response is never read again
+func (rc *Cache) forget(key string) {
+	rc.mu.Lock()
+	version, ok := rc.versions[key]
+	delete(rc.versions, key)
+	rc.mu.Unlock()
+	if ok {
+		rc.drop(versioned(key, version))
+	}
+}
+
+// drop removes the responses of versions no longer used from the group
+func (rc *Cache) drop(vkeys ...string) {
+	for _, vkey := range vkeys {
+		_ = rc.group.Remove(context.Background(), vkey)
+	}
+}
+
+func versioned(key string, version uint64) string {
+	return key + "#" + strconv.FormatUint(version, 10)
+}
+
+// load is the Getter of the group, it runs the handlers of the request owning the key
+func (rc *Cache) load(vkey string) ([]byte, error) {
+	rc.mu.Lock()
+	r, ok := rc.pending[vkey]
+	rc.mu.Unlock()
+	if !ok {
+		// eg. asked by a peer, the response can only be produced by a request, see Group
+		return nil, errors.New("respcache: no request is rendering " + vkey)
+	}
+	r.entry = rc.render(r.c)
+	if !rc.cacheable(r.entry) {
+		return nil, errNotCacheable
+	}
+	return encode(r.entry)
+}
+
+// render runs the following handlers with their response held in memory
+func (rc *Cache) render(c *bee.Context) *entry {
+	writer := c.Writer
+	buf := &bufferWriter{header: make(http.Header)}
+	c.Writer = buf
+	// restored on panic too, so the recovery writes to the client
+	defer func() { c.Writer = writer }()
+	c.Next()
+
+	e := &entry{
+		Status:  buf.status,
+		Header:  buf.header,
+		Body:    buf.body.Bytes(),
+		ETag:    buf.header.Get("ETag"),
+		Created: rc.now(),
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	if e.ETag == "" {
+		e.ETag = strongETag(e.Body)
+	}
+	e.Header.Del("ETag")
+	return e
+}
+
+// cacheable decides whether the entry may be stored and sets its expiration
+func (rc *Cache) cacheable(e *entry) bool {
+	cc := parseCacheControl(e.Header.Get("Cache-Control"))
+	if e.Status != http.StatusOK || cc.has("no-store") || cc.has("private") || cc.has("no-cache") ||
+		e.Header.Get("Set-Cookie") != "" || e.Header.Get("Vary") == "*" {
+		return false
+	}
+	ttl := rc.opts.DefaultTTL
+	if seconds := cc.maxAge(); seconds >= 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return false
+	}
+	e.Expires = e.Created.Add(ttl)
+	return true
+}
+
+// serve writes the entry, answers 304 if the request already has it
+func (rc *Cache) serve(c *bee.Context, e *entry, status string) {
+	c.Abort()
+	header := c.Writer.Header()
+	for key, values := range e.Header {
+		header[key] = values
+	}
+	header.Set("X-Cache", status)
+	if e.ETag != "" {
+		header.Set("ETag", e.ETag)
+	}
+	if status == "HIT" {
+		header.Set("Age", strconv.Itoa(int(rc.now().Sub(e.Created).Seconds())))
+	}
+	if e.ETag != "" && etagMatch(c.Req.Header.Get("If-None-Match"), e.ETag) {
+		header.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(e.Status, e.Body)
+}
+
+func decode(data []byte) (*entry, error) {
+	e := &entry{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(e)
+	return e, err
+}
+
+func encode(e *entry) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(e)
+	return buf.Bytes(), err
+}
+
+// strongETag computes an etag from the body
+func strongETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatch reports whether the If-None-Match header matches etag, using the weak comparison
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header string) cacheControl {
+	cc := make(cacheControl)
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(directive, "=")
+		cc[name] = strings.Trim(value, `"`)
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// maxAge returns s-maxage or max-age, -1 if neither is present or valid
+func (cc cacheControl) maxAge() int {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := cc[name]; ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				return seconds
+			}
+		}
+	}
+	return -1
+}
+
+// bufferWriter holds the response of the handlers so it can be cached before being sent
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
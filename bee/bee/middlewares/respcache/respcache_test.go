@@ -0,0 +1,134 @@
+package respcache
+
+import (
+	"bee"
+	"bee/beetest"
+	"bee/middlewares"
+	"beeCache"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestEngine(rc *Cache, calls *int) *bee.Engine {
+	r := bee.New()
+	r.Use(rc.Middleware())
+	r.GET("/users/:id", func(c *bee.Context) {
+		*calls++
+		c.SetHeader("X-Lang", c.Query("lang"))
+		c.String(http.StatusOK, "user %s #%d", c.Param("id"), *calls)
+	})
+	r.GET("/private", func(c *bee.Context) {
+		*calls++
+		c.SetHeader("Cache-Control", "private")
+		c.String(http.StatusOK, "secret")
+	})
+	return r
+}
+
+func TestCache(t *testing.T) {
+	calls := 0
+	rc := New("respcache-test", 1<<20, Options{QueryParams: []string{"lang"}, DefaultTTL: time.Minute})
+	client := beetest.New(t, newTestEngine(rc, &calls))
+
+	first := client.GET("/users/1").WithQuery("lang", "en").Do().
+		Status(http.StatusOK).Header("X-Cache", "MISS").BodyEquals("user 1 #1")
+	client.GET("/users/1").WithQuery("lang", "en").WithQuery("ignored", "x").Do().
+		Status(http.StatusOK).Header("X-Cache", "HIT").Header("X-Lang", "en").BodyEquals("user 1 #1")
+	client.GET("/users/1").WithQuery("lang", "zh").Do().Header("X-Cache", "MISS").BodyEquals("user 1 #2")
+
+	etag := first.Result().Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("etag missing")
+	}
+	client.GET("/users/1").WithQuery("lang", "en").WithHeader("If-None-Match", etag).Do().
+		Status(http.StatusNotModified).BodyEquals("")
+
+	client.GET("/private").Do().Header("X-Cache", "MISS")
+	client.GET("/private").Do().Header("X-Cache", "MISS")
+	if calls != 4 {
+		t.Fatalf("expect 4 handler calls, got %d", calls)
+	}
+}
+
+func TestCacheExpireAndInvalidate(t *testing.T) {
+	calls := 0
+	now := time.Now()
+	rc := New("respcache-expire-test", 1<<20, Options{DefaultTTL: time.Minute})
+	rc.now = func() time.Time { return now }
+	client := beetest.New(t, newTestEngine(rc, &calls))
+
+	client.GET("/users/1").Do().BodyEquals("user 1 #1")
+	client.GET("/users/2").Do().BodyEquals("user 2 #2")
+	client.GET("/users/1").Do().Header("X-Cache", "HIT")
+
+	now = now.Add(2 * time.Minute)
+	client.GET("/users/1").Do().Header("X-Cache", "MISS").BodyEquals("user 1 #3")
+	client.GET("/users/1").Do().Header("X-Cache", "HIT").BodyEquals("user 1 #3")
+
+	if n := rc.Invalidate("GET /users/"); n != 2 {
+		t.Fatalf("expect 2 keys invalidated, got %d", n)
+	}
+	client.GET("/users/1").Do().Header("X-Cache", "MISS").BodyEquals("user 1 #4")
+
+	client.GET("/users/1").WithHeader("Cache-Control", "no-cache").Do().Header("X-Cache", "MISS")
+	client.GET("/users/1").WithHeader("Cache-Control", "no-store").Do().BodyEquals("user 1 #6")
+}
+
+func TestCachePanic(t *testing.T) {
+	calls := 0
+	rc := New("respcache-panic-test", 1<<20, Options{DefaultTTL: time.Minute})
+	r := bee.New()
+	r.Use(middlewares.Recovery(), rc.Middleware())
+	r.GET("/flaky", func(c *bee.Context) {
+		if calls++; calls == 1 {
+			panic("boom")
+		}
+		c.String(http.StatusOK, "ok #%d", calls)
+	})
+	client := beetest.New(t, r)
+
+	client.GET("/flaky").Do().Status(http.StatusInternalServerError).JSON("message", "Internal Server Error")
+	if len(rc.pending) != 0 {
+		t.Fatalf("the key should be released, got %v", rc.pending)
+	}
+	client.GET("/flaky").Do().Status(http.StatusOK).Header("X-Cache", "MISS").BodyEquals("ok #2")
+	client.GET("/flaky").Do().Status(http.StatusOK).Header("X-Cache", "HIT").BodyEquals("ok #2")
+}
+
+func TestCacheMaxKeys(t *testing.T) {
+	calls := 0
+	rc := New("respcache-maxkeys-test", 1<<20, Options{QueryParams: []string{"page"}, DefaultTTL: time.Minute, MaxKeys: 3})
+	client := beetest.New(t, newTestEngine(rc, &calls))
+
+	for i := 0; i < 10; i++ {
+		client.GET("/users/1").WithQuery("page", fmt.Sprint(i)).Do().Header("X-Cache", "MISS")
+	}
+	if len(rc.versions) > 3 {
+		t.Fatalf("expect at most 3 keys tracked, got %d", len(rc.versions))
+	}
+	// the responses of the forgotten keys are removed too
+	if items := rc.Group().CacheStats(beeCache.MainCache).Items; items > 3 {
+		t.Fatalf("expect at most 3 responses cached, got %d", items)
+	}
+	client.GET("/users/1").WithQuery("page", "0").Do().Header("X-Cache", "MISS").BodyEquals("user 1 #11")
+
+	client.GET("/users/1").WithQuery("page", "0").WithHeader("Cache-Control", "no-cache").Do().Header("X-Cache", "MISS")
+	if items := rc.Group().CacheStats(beeCache.MainCache).Items; items > 3 {
+		t.Fatalf("the superseded response should be removed, got %d cached", items)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	cc := parseCacheControl(`public, max-age=60, s-maxage="30"`)
+	if !cc.has("public") || cc.maxAge() != 30 {
+		t.Fatalf("unexpected cache control %v", cc)
+	}
+	if parseCacheControl("no-cache").maxAge() != -1 {
+		t.Fatal("max-age should be absent")
+	}
+	if !etagMatch(`W/"a", "b"`, `"a"`) || etagMatch(`"b"`, `"a"`) {
+		t.Fatal("unexpected etag comparison")
+	}
+}
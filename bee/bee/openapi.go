@@ -0,0 +1,376 @@
+package bee
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route is a registered route, the metadata set on it is used to generate the OpenAPI document.
+// The routing table holds a copy of it which is replaced on each change, so it can be described while serving.
+type Route struct {
+	Method      string
+	Pattern     string
+	summary     string
+	description string
+	tags        []string
+	request     reflect.Type
+	responses   map[int]reflect.Type
+
+	router *router
+	group  *RouterGroup // the group it was registered in
+	origin *Route       // the Route returned by the registration, shared by its copies
+}
+
+// Summary sets the short summary of the operation
+func (r *Route) Summary(summary string) *Route {
+	return r.edit(func(r *Route) { r.summary = summary })
+}
+
+// Description sets the verbose explanation of the operation
+func (r *Route) Description(description string) *Route {
+	return r.edit(func(r *Route) { r.description = description })
+}
+
+// Tags groups the operation in the document
+func (r *Route) Tags(tags ...string) *Route {
+	return r.edit(func(r *Route) { r.tags = append(r.tags, tags...) })
+}
+
+// Request sets the type of the json request body, v is a value of that type, eg User{} or (*User)(nil)
+func (r *Route) Request(v interface{}) *Route {
+	return r.edit(func(r *Route) { r.request = reflect.TypeOf(v) })
+}
+
+// Response sets the type of the json response body for the status code, v may be nil for an empty body
+func (r *Route) Response(code int, v interface{}) *Route {
+	return r.edit(func(r *Route) {
+		if r.responses == nil {
+			r.responses = make(map[int]reflect.Type)
+		}
+		r.responses[code] = reflect.TypeOf(v)
+	})
+}
+
+// edit applies fn to the route and to the copy held by the routing table
+func (r *Route) edit(fn func(r *Route)) *Route {
+	if r.router != nil {
+		r.router.editRoute(r, fn)
+	}
+	// r 是调用者持有的副本，路由表中的不受影响
+	fn(r)
+	return r
+}
+
+// copy returns a copy of the route not sharing the tags nor the responses
+func (r *Route) copy() *Route {
+	c := *r
+	c.tags = slices.Clone(r.tags)
+	c.responses = maps.Clone(r.responses)
+	return &c
+}
+
+// OpenAPIInfo is the info object of the generated document
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// Routes returns copies of all registered routes sorted by pattern and method
+func (e *Engine) Routes() []*Route {
+	var routes []*Route
+	t := e.router.table.Load()
+	for _, root := range t.roots {
+		var nodes []*node
+		root.travel(&nodes)
+		for _, n := range nodes {
+			if n.route != nil {
+				routes = append(routes, n.route.copy())
+			}
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// OpenAPI generates an OpenAPI 3 document from the registered routes
+func (e *Engine) OpenAPI(info OpenAPIInfo) H {
+	g := &schemaGenerator{components: H{}, names: map[reflect.Type]string{}}
+	paths := H{}
+	for _, route := range e.Routes() {
+		path, params := openAPIPath(route.Pattern)
+		item, ok := paths[path].(H)
+		if !ok {
+			item = H{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route, params)
+	}
+	infoObj := H{"title": info.Title, "version": info.Version}
+	if info.Description != "" {
+		infoObj["description"] = info.Description
+	}
+	doc := H{
+		"openapi": "3.0.3",
+		"info":    infoObj,
+		"paths":   paths,
+	}
+	if len(g.components) > 0 {
+		doc["components"] = H{"schemas": g.components}
+	}
+	return doc
+}
+
+// ServeOpenAPI registers a GET route serving the document, it's encoded as YAML if the path ends with .yaml or .yml
+func (rg *RouterGroup) ServeOpenAPI(pattern string, info OpenAPIInfo) *Route {
+	yaml := strings.HasSuffix(pattern, ".yaml") || strings.HasSuffix(pattern, ".yml")
+	return rg.GET(pattern, func(c *Context) {
+		doc := c.engine.OpenAPI(info)
+		if yaml {
+			c.SetHeader("Content-Type", "application/yaml")
+			c.Data(http.StatusOK, []byte(encodeYAML(doc)))
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	})
+}
+
+// openAPIPath converts /users/:id/*filepath to /users/{id}/{filepath} and returns the param names
+func openAPIPath(pattern string) (string, []string) {
+	parts := parsePattern(pattern)
+	var params []string
+	for i, part := range parts {
+		if (part[0] == ':' || part[0] == '*') && len(part) > 1 {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return "/" + strings.Join(parts, "/"), params
+}
+
+type schemaGenerator struct {
+	components H
+	names      map[reflect.Type]string // the component of each named struct
+}
+
+func (g *schemaGenerator) operation(route *Route, params []string) H {
+	op := H{}
+	if route.summary != "" {
+		op["summary"] = route.summary
+	}
+	if route.description != "" {
+		op["description"] = route.description
+	}
+	if len(route.tags) > 0 {
+		op["tags"] = route.tags
+	}
+	if len(params) > 0 {
+		list := make([]interface{}, 0, len(params))
+		for _, name := range params {
+			list = append(list, H{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   H{"type": "string"},
+			})
+		}
+		op["parameters"] = list
+	}
+	if route.request != nil {
+		op["requestBody"] = H{
+			"required": true,
+			"content":  H{"application/json": H{"schema": g.schema(route.request)}},
+		}
+	}
+	responses := H{}
+	for code, typ := range route.responses {
+		resp := H{"description": http.StatusText(code)}
+		if typ != nil {
+			resp["content"] = H{"application/json": H{"schema": g.schema(typ)}}
+		}
+		responses[strconv.Itoa(code)] = resp
+	}
+	if len(responses) == 0 {
+		responses["default"] = H{"description": "response"}
+	}
+	op["responses"] = responses
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t, named structs are put in components and referenced
+func (g *schemaGenerator) schema(t reflect.Type) H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return H{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return H{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return H{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return H{"type": "number", "format": "double"}
+	case reflect.String:
+		return H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return H{"type": "string", "format": "byte"}
+		}
+		return H{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return H{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.componentName(t)
+			g.names[t] = name
+			// placeholder to stop the recursion of self-referencing types
+			g.components[name] = H{}
+			g.components[name] = g.structSchema(t)
+		}
+		return H{"$ref": "#/components/schemas/" + name}
+	default:
+		return H{}
+	}
+}
+
+// invalidComponentChars are the characters a component key can't have, eg. the brackets of the generic types
+var invalidComponentChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// componentName returns the key of t in the components: the name of its package and its own, eg. bee.User.
+// The full package path is used if another type already has the key.
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	key := func(name string) string {
+		return strings.Trim(invalidComponentChars.ReplaceAllString(name, "_"), "_")
+	}
+	name := key(path.Base(t.PkgPath()) + "." + t.Name())
+	if _, taken := g.components[name]; taken {
+		name = key(t.PkgPath() + "." + t.Name())
+	}
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) H {
+	properties := H{}
+	var required []string
+	g.fields(t, properties, &required)
+	schema := H{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fields collects the json fields of t, the fields of embedded structs are inlined like encoding/json does
+func (g *schemaGenerator) fields(t reflect.Type, properties H, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		ft := field.Type
+		if field.Anonymous && name == "" {
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(ft)
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// encodeYAML encodes the document built of H, slices and scalars as YAML
+func encodeYAML(v interface{}) string {
+	var sb strings.Builder
+	writeYAML(&sb, v, 0)
+	return sb.String()
+}
+
+func writeYAML(sb *strings.Builder, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch value := v.(type) {
+	case H:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString(pad + yamlScalar(key) + ":")
+			writeYAMLValue(sb, value[key], indent)
+		}
+	default:
+		items := reflect.ValueOf(v)
+		for i := 0; i < items.Len(); i++ {
+			sb.WriteString(pad + "-")
+			writeYAMLValue(sb, items.Index(i).Interface(), indent)
+		}
+	}
+}
+
+// writeYAMLValue writes the value following a key or a list dash
+func writeYAMLValue(sb *strings.Builder, v interface{}, indent int) {
+	switch value := v.(type) {
+	case H:
+		if len(value) == 0 {
+			sb.WriteString(" {}\n")
+			return
+		}
+		sb.WriteString("\n")
+		writeYAML(sb, value, indent+1)
+	case []string, []interface{}:
+		if reflect.ValueOf(value).Len() == 0 {
+			sb.WriteString(" []\n")
+			return
+		}
+		sb.WriteString("\n")
+		writeYAML(sb, value, indent+1)
+	default:
+		sb.WriteString(" " + yamlScalar(value) + "\n")
+	}
+}
+
+// yamlScalar encodes v as json, json strings are valid yaml double-quoted scalars
+func yamlScalar(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,107 @@
+package bee
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"maps"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+type apiUser struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email,omitempty"`
+	Friends []apiUser `json:"friends,omitempty"`
+	secret  string
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path, params := openAPIPath("/users/:id/files/*filepath")
+	if path != "/users/{id}/files/{filepath}" || !reflect.DeepEqual(params, []string{"id", "filepath"}) {
+		t.Fatalf("unexpected path %s and params %v", path, params)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	v1.GET("/users/:id", nil).Summary("get a user").Tags("users").Response(200, apiUser{})
+	v1.POST("/users", nil).Tags("users").Request(apiUser{}).Response(201, &apiUser{})
+	r.ServeOpenAPI("/openapi.json", OpenAPIInfo{Title: "bee", Version: "1.0"})
+
+	data, _ := json.Marshal(r.OpenAPI(OpenAPIInfo{Title: "bee", Version: "1.0"}))
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	paths := doc["paths"].(map[string]interface{})
+	get := paths["/v1/users/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	if get["summary"] != "get a user" {
+		t.Fatalf("unexpected operation %v", get)
+	}
+	param := get["parameters"].([]interface{})[0].(map[string]interface{})
+	if param["name"] != "id" || param["in"] != "path" {
+		t.Fatalf("unexpected parameter %v", param)
+	}
+	if _, ok := paths["/v1/users"].(map[string]interface{})["post"]; !ok {
+		t.Fatal("post operation missing")
+	}
+	if _, ok := paths["/openapi.json"]; !ok {
+		t.Fatal("document route missing")
+	}
+	user := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})["bee.apiUser"].(map[string]interface{})
+	props := user["properties"].(map[string]interface{})
+	if len(props) != 4 || props["friends"].(map[string]interface{})["items"].(map[string]interface{})["$ref"] != "#/components/schemas/bee.apiUser" {
+		t.Fatalf("unexpected schema %v", user)
+	}
+	if !reflect.DeepEqual(user["required"], []interface{}{"id", "name"}) {
+		t.Fatalf("unexpected required fields %v", user["required"])
+	}
+}
+
+type apiPage[T any] struct {
+	Items []T `json:"items"`
+}
+
+func TestOpenAPIComponentNames(t *testing.T) {
+	r := New()
+	r.GET("/users", nil).Response(200, apiPage[apiUser]{})
+	r.GET("/text", nil).Response(200, texttemplate.Template{})
+	r.GET("/html", nil).Response(200, htmltemplate.Template{})
+
+	schemas := r.OpenAPI(OpenAPIInfo{})["components"].(H)["schemas"].(H)
+	names := slices.Sorted(maps.Keys(schemas))
+	if _, ok := schemas["bee.apiPage_bee.apiUser"]; !ok {
+		t.Fatalf("expect the generic type named without brackets, got %v", names)
+	}
+	// the types of the same name from different packages get their own component
+	var templates []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "template.Template") {
+			templates = append(templates, name)
+		}
+	}
+	if !reflect.DeepEqual(templates, []string{"template.Template", "text_template.Template"}) {
+		t.Fatalf("expect a component per template type, got %v", names)
+	}
+}
+
+func TestServeOpenAPIYAML(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", nil).Summary("say hello")
+	r.ServeOpenAPI("/openapi.yaml", OpenAPIInfo{Title: "bee", Version: "1.0"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	body := w.Body.String()
+	for _, want := range []string{"\"openapi\": \"3.0.3\"", "\"/hello/{name}\":\n", "\"summary\": \"say hello\""} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("yaml document doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package bee
+
+import (
+	"net"
+	"strings"
+)
+
+// SetTrustedProxies sets the CIDRs(or single IPs) of the proxies whose forwarding headers are believed.
+// No proxy is trusted by default, it should be called before serving.
+func (e *Engine) SetTrustedProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, ipNet)
+	}
+	e.trustedProxies = nets
+	return nil
+}
+
+func (e *Engine) isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range e.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hop is a forwarding step, ip is the address the request came from, proto and host are what it asked for
+type hop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// ClientIP returns the address of the client.
+// The forwarding headers(Forwarded, X-Forwarded-For, X-Real-IP) are only used when the request comes from
+// a trusted proxy, they are read from right to left and the first address which isn't a trusted proxy wins.
+func (ctx *Context) ClientIP() string {
+	if client := ctx.client(); client.ip != nil {
+		return client.ip.String()
+	}
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		return ctx.Req.RemoteAddr
+	}
+	return host
+}
+
+// Scheme returns http or https as requested by the client
+func (ctx *Context) Scheme() string {
+	if proto := strings.ToLower(ctx.client().proto); proto == "http" || proto == "https" {
+		return proto
+	}
+	if ctx.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host requested by the client
+func (ctx *Context) Host() string {
+	if host := ctx.client().host; host != "" {
+		return host
+	}
+	return ctx.Req.Host
+}
+
+// client resolves the hop of the client, the result is the remote peer if it isn't a trusted proxy
+func (ctx *Context) client() hop {
+	remote := hop{ip: parseIP(ctx.Req.RemoteAddr)}
+	if remote.ip == nil || ctx.engine == nil || !ctx.engine.isTrustedProxy(remote.ip) {
+		return remote
+	}
+	header := ctx.Req.Header
+	var hops []hop
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		hops = parseForwarded(strings.Join(forwarded, ","))
+	} else if xff := header.Values("X-Forwarded-For"); len(xff) > 0 {
+		proto, host := lastValue(header.Values("X-Forwarded-Proto")), lastValue(header.Values("X-Forwarded-Host"))
+		for _, addr := range strings.Split(strings.Join(xff, ","), ",") {
+			hops = append(hops, hop{ip: parseIP(strings.TrimSpace(addr)), proto: proto, host: host})
+		}
+	} else if realIP := parseIP(header.Get("X-Real-IP")); realIP != nil {
+		hops = []hop{{ip: realIP, proto: lastValue(header.Values("X-Forwarded-Proto")), host: lastValue(header.Values("X-Forwarded-Host"))}}
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].ip == nil {
+			// an address we can't understand, stop at the last trusted one
+			break
+		}
+		client = hops[i]
+		if !ctx.engine.isTrustedProxy(client.ip) {
+			break
+		}
+	}
+	return client
+}
+
+// parseForwarded parses the RFC 7239 Forwarded header, one hop per element
+func parseForwarded(header string) []hop {
+	var hops []hop
+	for _, element := range splitQuoted(header, ',') {
+		var h hop
+		for _, pair := range splitQuoted(element, ';') {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "for":
+				h.ip = parseIP(value)
+			case "proto":
+				h.proto = value
+			case "host":
+				h.host = value
+			}
+		}
+		hops = append(hops, h)
+	}
+	return hops
+}
+
+// splitQuoted splits s by sep outside of double quotes
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseIP parses an address with an optional port, ipv6 may be in brackets; nil for "unknown" or obfuscated ones
+func parseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
+
+// lastValue returns the rightmost value of a comma separated header, it's the one set by the nearest proxy
+func lastValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	parts := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(parts[len(parts)-1])
+}
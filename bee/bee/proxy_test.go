@@ -0,0 +1,69 @@
+package bee
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func newProxyContext(e *Engine, remote string, headers map[string]string) *Context {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remote
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return e.NewContext(httptest.NewRecorder(), req)
+}
+
+func TestClientIP(t *testing.T) {
+	e := New()
+	if err := e.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{"direct", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"spoofed by untrusted peer", "203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"}, "203.0.113.9"},
+		{"x-forwarded-for", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"all trusted", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage stops the walk", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, nonsense, 10.0.0.2"}, "10.0.0.2"},
+		{"x-real-ip", "192.168.1.1:80", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"forwarded", "[2001:db8::1]:443", map[string]string{"Forwarded": `for=198.51.100.7;proto=https, for="[2001:db8:cafe::17]:4711"`, "X-Forwarded-For": "1.1.1.1"}, "198.51.100.7"},
+		{"forwarded unknown", "10.0.0.1:80", map[string]string{"Forwarded": "for=unknown, for=10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tc := range cases {
+		if ip := newProxyContext(e, tc.remote, tc.headers).ClientIP(); ip != tc.ip {
+			t.Errorf("%s: got %s, want %s", tc.name, ip, tc.ip)
+		}
+	}
+}
+
+func TestSchemeAndHost(t *testing.T) {
+	e := New()
+	if err := e.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newProxyContext(e, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "bee.dev"})
+	if c.Scheme() != "https" || c.Host() != "bee.dev" {
+		t.Errorf("expect https://bee.dev, got %s://%s", c.Scheme(), c.Host())
+	}
+	c = newProxyContext(e, "10.0.0.1:80", map[string]string{"Forwarded": `for=1.2.3.4;proto=https;host="api.bee.dev"`})
+	if c.Scheme() != "https" || c.Host() != "api.bee.dev" {
+		t.Errorf("expect https://api.bee.dev, got %s://%s", c.Scheme(), c.Host())
+	}
+	c = newProxyContext(e, "203.0.113.9:1234", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.dev"})
+	if c.Scheme() != "http" || c.Host() != "example.com" {
+		t.Errorf("headers of untrusted peer should be ignored, got %s://%s", c.Scheme(), c.Host())
+	}
+	c.Req.TLS = &tls.ConnectionState{}
+	if c.Scheme() != "https" {
+		t.Errorf("tls request should be https")
+	}
+	if err := e.SetTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid cidr should be rejected")
+	}
+}
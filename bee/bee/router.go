@@ -3,20 +3,50 @@ package bee
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // router struct
+// The requests are served from an immutable routeTable, the changes are applied to a copy
+// which then replaces it atomically(copy-on-write), so routes can be changed while serving.
+// Only the nodes along the path of a change are copied, see node.
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	mu    sync.Mutex // serialize the changes
+	table atomic.Pointer[routeTable]
+}
+
+// routeTable is a snapshot of the routes, it must not be modified once published.
+// The handlers and the routes are held by the leaves of the tries.
+type routeTable struct {
+	roots map[string]*node
 }
 
 func newRouter() *router {
-	return &router{
-		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+	r := &router{}
+	r.table.Store(&routeTable{roots: make(map[string]*node)})
+	return r
+}
+
+// clone copies the roots of the table, the tries are shared and never modified
+func (t *routeTable) clone() *routeTable {
+	c := &routeTable{roots: make(map[string]*node, len(t.roots))}
+	for method, root := range t.roots {
+		c.roots[method] = root
 	}
+	return c
+}
+
+// update applies fn to a copy of the current table and publishes it
+func (r *router) update(fn func(t *routeTable)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.table.Load().clone()
+	fn(t)
+	r.table.Store(t)
 }
 
 // parsePattern 解析路径模式（只允许存在一个*）
@@ -34,24 +64,93 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-func (r *router) addRoute(method, pattern string, handler HandlerFunc) {
+// addRoute registers the route of the group, the returned Route is a handle: the table holds a copy of it
+func (r *router) addRoute(method, pattern string, handler HandlerFunc, group *RouterGroup) *Route {
 	log.Printf("Route %4s -> %s", method, pattern)
-	parts := parsePattern(pattern)
-	key := method + "-" + pattern
-	//group by method
-	_, ok := r.roots[method]
-	if !ok {
-		r.roots[method] = &node{}
+	route := &Route{Method: method, Pattern: pattern, router: r, group: group}
+	route.origin = route
+	stored := route.copy()
+	r.update(func(t *routeTable) {
+		//group by method
+		root, ok := t.roots[method]
+		if !ok {
+			root = &node{}
+		}
+		t.roots[method] = root.insert(pattern, parsePattern(pattern), 0, handler, stored)
+	})
+	return route
+}
+
+// editRoute replaces the copy of the route in the table by one modified by fn, nothing is done
+// if the route has been removed or registered again since
+func (r *router) editRoute(route *Route, fn func(r *Route)) {
+	parts := parsePattern(route.Pattern)
+	r.update(func(t *routeTable) {
+		root, ok := t.roots[route.Method]
+		if !ok {
+			return
+		}
+		leaf := root.lookup(route.Pattern, parts, 0)
+		if leaf == nil || leaf.route.origin != route.origin {
+			return
+		}
+		edited := leaf.route.copy()
+		fn(edited)
+		t.roots[route.Method] = root.insert(route.Pattern, parts, 0, leaf.handler, edited)
+	})
+}
+
+// removeRoute removes the route registered with exactly the method and pattern
+func (r *router) removeRoute(method, pattern string) bool {
+	removed := false
+	r.update(func(t *routeTable) {
+		root, ok := t.roots[method]
+		if !ok {
+			return
+		}
+		if root = root.remove(pattern, parsePattern(pattern), 0); root != nil {
+			t.roots[method] = root
+			removed = true
+		}
+	})
+	if removed {
+		log.Printf("Route %4s xx %s", method, pattern)
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	return removed
+}
+
+// removeGroup removes the routes registered in the group or in the groups created from it
+func (r *router) removeGroup(group *RouterGroup) int {
+	var removed []*Route
+	r.update(func(t *routeTable) {
+		for method, root := range t.roots {
+			var nodes []*node
+			root.travel(&nodes)
+			for _, n := range nodes {
+				if n.route == nil || n.route.group == nil || !n.route.group.within(group) {
+					continue
+				}
+				root = root.remove(n.pattern, parsePattern(n.pattern), 0)
+				removed = append(removed, n.route)
+			}
+			t.roots[method] = root
+		}
+	})
+	for _, route := range removed {
+		log.Printf("Route %4s xx %s", route.Method, route.Pattern)
+	}
+	return len(removed)
 }
 
 // getRoute 判断路由规则是否存在并且保存对应的路由参数
 func (r *router) getRoute(method string, path string) (*node, map[string]string) {
+	return r.table.Load().getRoute(method, path)
+}
+
+func (t *routeTable) getRoute(method string, path string) (*node, map[string]string) {
 	searchParts := parsePattern(path)
 	params := make(map[string]string)
-	root, ok := r.roots[method]
+	root, ok := t.roots[method]
 
 	if !ok {
 		return nil, nil
@@ -77,12 +176,42 @@ func (r *router) getRoute(method string, path string) (*node, map[string]string)
 }
 
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
-	if n != nil {
+	t := r.table.Load()
+	path := c.Path
+	if c.engine.UseRawPath && c.Req.URL.RawPath != "" {
+		path = c.Req.URL.EscapedPath()
+	}
+	if c.engine.RedirectFixedPath {
+		if cleaned := cleanPath(path); cleaned != path {
+			if fixed, ok := t.fixedPath(c.Method, cleaned); ok {
+				c.handlers = append(c.handlers, redirect(fixed))
+				c.Next()
+				return
+			}
+		}
+	}
+	n, params := t.getRoute(c.Method, path)
+	switch {
+	case n != nil && c.engine.RedirectTrailingSlash && !trailingSlashMatch(path, n.pattern):
+		c.handlers = append(c.handlers, redirect(setTrailingSlash(cleanPath(path), strings.HasSuffix(n.pattern, "/"))))
+	case n != nil:
+		if c.engine.UseRawPath && c.engine.UnescapePathValues {
+			for key, value := range params {
+				if unescaped, err := url.PathUnescape(value); err == nil {
+					params[key] = unescaped
+				}
+			}
+		}
 		c.Params = params
-		key := c.Method + "-" + n.pattern
-		c.handlers = append(c.handlers, r.handlers[key])
-	} else {
+		c.Pattern = n.pattern
+		c.handlers = append(c.handlers, n.handler)
+	default:
+		if c.engine.RedirectFixedPath {
+			if fixed, ok := t.fixedPath(c.Method, path); ok {
+				c.handlers = append(c.handlers, redirect(fixed))
+				break
+			}
+		}
 		c.handlers = append(c.handlers, func(c *Context) {
 			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
 		})
@@ -90,3 +219,77 @@ func (r *router) handle(c *Context) {
 	//call next to deal all handlers registered to the context
 	c.Next()
 }
+
+// fixedPath looks up the path ignoring the case, and returns it spelled as registered
+func (t *routeTable) fixedPath(method, path string) (string, bool) {
+	root, ok := t.roots[method]
+	if !ok {
+		return "", false
+	}
+	searchParts := parsePattern(path)
+	n := root.searchFold(searchParts, 0)
+	if n == nil {
+		return "", false
+	}
+	parts := parsePattern(n.pattern)
+	for index, part := range parts {
+		if part[0] == ':' {
+			parts[index] = searchParts[index]
+		}
+		if part[0] == '*' {
+			parts = append(parts[:index], searchParts[index:]...)
+			break
+		}
+	}
+	fixed := "/" + strings.Join(parts, "/")
+	// the pattern / has no part
+	if len(parts) > 0 && !strings.HasPrefix(parts[len(parts)-1], "*") {
+		fixed = setTrailingSlash(fixed, strings.HasSuffix(n.pattern, "/"))
+	}
+	return fixed, true
+}
+
+// redirect uses 301 for GET requests and 308 for the others so that the method and body are kept
+func redirect(target string) HandlerFunc {
+	return func(c *Context) {
+		code := http.StatusPermanentRedirect
+		if c.Method == http.MethodGet {
+			code = http.StatusMovedPermanently
+		}
+		// 以 // 或 /\ 开头的地址会被浏览器当作另一个主机
+		location := "/" + strings.TrimLeft(target, "/\\")
+		if c.Req.URL.RawQuery != "" {
+			location += "?" + c.Req.URL.RawQuery
+		}
+		c.SetHeader("Location", location)
+		c.Status(code)
+	}
+}
+
+// trailingSlashMatch reports whether path and pattern agree on the trailing slash, wildcards match both
+func trailingSlashMatch(path, pattern string) bool {
+	if path == "/" || strings.Contains(pattern, "/*") {
+		return true
+	}
+	return strings.HasSuffix(path, "/") == strings.HasSuffix(pattern, "/")
+}
+
+func setTrailingSlash(path string, slash bool) string {
+	path = strings.TrimRight(path, "/")
+	if slash || path == "" {
+		path += "/"
+	}
+	return path
+}
+
+// cleanPath is path.Clean keeping the trailing slash
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if cleaned != "/" && strings.HasSuffix(p, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
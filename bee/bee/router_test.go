@@ -2,17 +2,20 @@ package bee
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 )
 
 func newTestRouter() *router {
 	r := newRouter()
-	r.addRoute("GET", "/", nil)
-	r.addRoute("GET", "/hello/:name", nil)
-	r.addRoute("GET", "/hello/b/c", nil)
-	r.addRoute("GET", "/hi/:name", nil)
-	r.addRoute("GET", "/static/*filepath", nil)
+	r.addRoute("GET", "/", nil, nil)
+	r.addRoute("GET", "/hello/:name", nil, nil)
+	r.addRoute("GET", "/hello/b/c", nil, nil)
+	r.addRoute("GET", "/hi/:name", nil, nil)
+	r.addRoute("GET", "/static/*filepath", nil, nil)
 	return r
 }
 
@@ -44,3 +47,224 @@ func TestGetRoute(t *testing.T) {
 	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
 
 }
+
+func TestCleanPath(t *testing.T) {
+	cases := map[string]string{
+		"":           "/",
+		"/a//b":      "/a/b",
+		"/a/./b/":    "/a/b/",
+		"/a/../b":    "/b",
+		"a/b":        "/a/b",
+		"/users/":    "/users/",
+		"/../../x//": "/x/",
+	}
+	for p, want := range cases {
+		if got := cleanPath(p); got != want {
+			t.Errorf("cleanPath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func serveTest(e *Engine, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestRedirect(t *testing.T) {
+	e := New()
+	e.RedirectTrailingSlash, e.RedirectFixedPath = true, true
+	e.GET("/", func(c *Context) { c.String(http.StatusOK, "index") })
+	e.GET("/users", func(c *Context) { c.String(http.StatusOK, "users") })
+	e.GET("/Hello/:name/", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("name")) })
+	e.POST("/users", func(c *Context) { c.String(http.StatusOK, "created") })
+
+	cases := []struct {
+		method, target string
+		code           int
+		location       string
+	}{
+		{"GET", "/users", http.StatusOK, ""},
+		{"GET", "/users/?page=2", http.StatusMovedPermanently, "/users?page=2"},
+		{"POST", "/users/", http.StatusPermanentRedirect, "/users"},
+		{"GET", "/Hello/bee", http.StatusMovedPermanently, "/Hello/bee/"},
+		{"GET", "/a/../users", http.StatusMovedPermanently, "/users"},
+		{"GET", "//users", http.StatusMovedPermanently, "/users"},
+		{"GET", "/USERS", http.StatusMovedPermanently, "/users"},
+		{"GET", "/hello/Bee/", http.StatusMovedPermanently, "/Hello/Bee/"},
+		{"GET", "/nowhere", http.StatusNotFound, ""},
+		{"GET", "//", http.StatusMovedPermanently, "/"},
+		{"GET", "/./", http.StatusMovedPermanently, "/"},
+		{"GET", "/a/..", http.StatusMovedPermanently, "/"},
+	}
+	for _, tc := range cases {
+		w := serveTest(e, tc.method, tc.target)
+		if w.Code != tc.code || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.method, tc.target, w.Code, w.Header().Get("Location"), tc.code, tc.location)
+		}
+	}
+
+	e.RedirectTrailingSlash, e.RedirectFixedPath = false, false
+	if w := serveTest(e, "GET", "/users/"); w.Code != http.StatusOK {
+		t.Errorf("trailing slash should be ignored without redirect, got %d", w.Code)
+	}
+	if w := serveTest(e, "GET", "/USERS"); w.Code != http.StatusNotFound {
+		t.Errorf("case should matter without RedirectFixedPath, got %d", w.Code)
+	}
+}
+
+func TestRedirectOtherHost(t *testing.T) {
+	e := New()
+	e.RedirectTrailingSlash = true
+	e.GET("/:name", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("name")) })
+	for _, target := range []string{"//evil.com/", "///evil.com/", "/\\evil.com/"} {
+		w := serveTest(e, "GET", target)
+		if location := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || location != "/evil.com" {
+			t.Errorf("%s: got %d %q, want a redirect to /evil.com", target, w.Code, location)
+		}
+	}
+	if w := serveTest(e, "GET", "//evil.com"); w.Code != http.StatusOK {
+		t.Errorf("expect the route served, got %d", w.Code)
+	}
+}
+
+func TestRawPath(t *testing.T) {
+	e := New()
+	e.GET("/files/:name", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("name")) })
+
+	if w := serveTest(e, "GET", "/files/a%2Fb"); w.Code != http.StatusNotFound {
+		t.Fatalf("decoded slash should split the path, got %d", w.Code)
+	}
+	e.UseRawPath = true
+	if w := serveTest(e, "GET", "/files/a%2Fb"); w.Body.String() != "a/b" {
+		t.Fatalf("expect unescaped param a/b, got %q", w.Body.String())
+	}
+	e.UnescapePathValues = false
+	if w := serveTest(e, "GET", "/files/a%2Fb"); w.Body.String() != "a%2Fb" {
+		t.Fatalf("expect raw param a%%2Fb, got %q", w.Body.String())
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	e := New()
+	ok := func(c *Context) { c.String(http.StatusOK, "ok") }
+	e.GET("/hello/:name", ok)
+	e.GET("/hello/b/c", ok)
+	e.GET("/v1/health", ok)
+	v1 := e.Group("/v1")
+	v1.GET("/users", ok)
+	v1.POST("/users", ok)
+	v1.Group("/v1/admin").GET("/stats", ok)
+
+	if !e.RemoveRoute("GET", "/hello/b/c") || e.RemoveRoute("GET", "/hello/b/c") {
+		t.Fatal("route should be removed exactly once")
+	}
+	if w := serveTest(e, "GET", "/hello/b/c"); w.Code != http.StatusNotFound {
+		t.Fatalf("removed route still served with %d", w.Code)
+	}
+	if w := serveTest(e, "GET", "/hello/bee"); w.Code != http.StatusOK {
+		t.Fatalf("sibling route lost, got %d", w.Code)
+	}
+	if n := e.RemoveGroup(v1); n != 3 {
+		t.Fatalf("expect 3 routes of the group removed, got %d", n)
+	}
+	if len(*e.chains.Load()) != 1 {
+		t.Fatal("groups created from the removed group should be removed")
+	}
+	if w := serveTest(e, "POST", "/v1/users"); w.Code != http.StatusNotFound {
+		t.Fatalf("route of removed group still served with %d", w.Code)
+	}
+	if w := serveTest(e, "GET", "/v1/health"); w.Code != http.StatusOK {
+		t.Fatalf("the route registered on the engine should be kept, got %d", w.Code)
+	}
+}
+
+func TestAddRouteCopiesPath(t *testing.T) {
+	r := newTestRouter()
+	before := r.table.Load().roots["GET"]
+	r.addRoute("GET", "/hello/b/d", nil, nil)
+	after := r.table.Load().roots["GET"]
+	hello, hi := before.children[before.matchChild("hello")], before.children[before.matchChild("hi")]
+	if after == before || after.children[after.matchChild("hello")] == hello {
+		t.Fatal("the nodes along the path should be copied")
+	}
+	if after.children[after.matchChild("hi")] != hi {
+		t.Fatal("the nodes off the path should be shared")
+	}
+	if n, _ := r.getRoute("GET", "/hello/b/d"); n == nil {
+		t.Fatal("route not added")
+	}
+	if n, _ := (&routeTable{roots: map[string]*node{"GET": before}}).getRoute("GET", "/hello/b/d"); n != nil {
+		t.Fatal("the published table shouldn't change")
+	}
+}
+
+// TestConcurrentRoutes changes the routes while serving, run it with -race
+func TestConcurrentRoutes(t *testing.T) {
+	e := New()
+	e.GET("/static", func(c *Context) { c.String(http.StatusOK, "static") })
+	doc := e.GET("/doc", func(c *Context) {})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if w := serveTest(e, "GET", "/static"); w.Code != http.StatusOK {
+					t.Errorf("stable route got %d", w.Code)
+					return
+				}
+				serveTest(e, "GET", fmt.Sprintf("/plugin/%d/hello", i))
+				_ = e.Routes()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		g := e.Group(fmt.Sprintf("/plugin/%d", i%4))
+		g.Use(func(c *Context) { c.Next() })
+		g.GET("/hello", func(c *Context) { c.String(http.StatusOK, "hello") })
+		e.GET(fmt.Sprintf("/tenant/%d", i), func(c *Context) {})
+		doc.Summary(fmt.Sprintf("summary %d", i)).Tags("tag")
+		if i%2 == 0 {
+			e.RemoveRoute("GET", fmt.Sprintf("/tenant/%d", i))
+			e.RemoveGroup(g)
+		}
+	}
+	close(done)
+	wg.Wait()
+	for _, route := range e.Routes() {
+		if route.Pattern == "/doc" && (route.summary != "summary 99" || len(route.tags) != 100) {
+			t.Fatalf("the last description should be kept, got %q with %d tags", route.summary, len(route.tags))
+		}
+	}
+}
+
+func TestGroupMiddlewareEmptySegments(t *testing.T) {
+	e := New()
+	admin := e.Group("/admin")
+	admin.Use(func(c *Context) { c.Fail(http.StatusUnauthorized, "denied") })
+	admin.GET("/stats", func(c *Context) { c.String(http.StatusOK, "stats") })
+	e.GET("/public", Chain(func(c *Context) {
+		if c.Query("token") == "" {
+			c.Fail(http.StatusUnauthorized, "denied")
+		}
+	}, func(c *Context) { c.String(http.StatusOK, "public") }))
+
+	for _, target := range []string{"/admin/stats", "//admin/stats", "/admin//stats", "///admin/stats/"} {
+		if w := serveTest(e, "GET", target); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: the middleware of the group should run, got %d", target, w.Code)
+		}
+	}
+	if w := serveTest(e, "GET", "//public"); w.Code != http.StatusUnauthorized {
+		t.Errorf("the chained guard should run, got %d", w.Code)
+	}
+	if w := serveTest(e, "GET", "/public?token=1"); w.Code != http.StatusOK || w.Body.String() != "public" {
+		t.Errorf("expect the handler after the guard, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,147 @@
+package bee
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are checked for changes
+const certCheckInterval = time.Second
+
+// RunH2C starts a http server speaking both HTTP/1.1 and HTTP/2 over cleartext(h2c)
+func (e *Engine) RunH2C(addr string) (err error) {
+	return e.h2cServer(addr).ListenAndServe()
+}
+
+// RunTLS starts a https server, the certificate is reloaded when the files change
+func (e *Engine) RunTLS(addr, certFile, keyFile string) (err error) {
+	srv, err := e.tlsServer(addr, certFile, keyFile, "")
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+// RunMutualTLS starts a https server which requires the clients to present a certificate signed by one of the CAs
+// in clientCAFile. The subject of the verified certificate is available through Context.ClientCertSubject.
+func (e *Engine) RunMutualTLS(addr, certFile, keyFile, clientCAFile string) (err error) {
+	srv, err := e.tlsServer(addr, certFile, keyFile, clientCAFile)
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (e *Engine) h2cServer(addr string) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: addr, Handler: e, Protocols: protocols}
+}
+
+// tlsServer builds a https server, mutual tls is enabled when clientCAFile isn't empty
+func (e *Engine) tlsServer(addr, certFile, keyFile, clientCAFile string) (*http.Server, error) {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("bee: no certificate found in " + clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &http.Server{Addr: addr, Handler: e, TLSConfig: config}, nil
+}
+
+// certReloader serves a key pair loaded from files and reloads it once the files are modified
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex // protect following
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	due := time.Since(r.checked) >= certCheckInterval
+	if due {
+		r.checked = time.Now()
+	}
+	r.mu.Unlock()
+	if due {
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(r.currentModTime()) {
+			// the files may be half written, keep serving the old certificate if they can't be loaded
+			if err := r.load(modTime); err != nil {
+				log.Printf("bee: reload certificate %s: %v", r.certFile, err)
+			}
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *certReloader) currentModTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modTime
+}
+
+// latestModTime returns the modification time of the newer file
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
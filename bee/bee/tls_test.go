@@ -0,0 +1,189 @@
+package bee
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert issues a certificate for cn signed by parent, it's self-signed if parent is nil
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"bee"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func serve(t *testing.T, srv *http.Server, useTLS bool) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if useTLS {
+			_ = srv.ServeTLS(ln, "", "")
+		} else {
+			_ = srv.Serve(ln)
+		}
+	}()
+	t.Cleanup(func() { _ = srv.Close() })
+	return ln.Addr().String()
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "bee-ca", 1, nil)
+	ca.write(t, caFile, "")
+	newTestCert(t, "server", 2, ca).write(t, certFile, keyFile)
+
+	r := New()
+	r.GET("/whoami", func(c *Context) {
+		subject, ok := c.ClientCertSubject()
+		if !ok {
+			c.Fail(http.StatusUnauthorized, "no client certificate")
+			return
+		}
+		c.String(http.StatusOK, "%s", subject.CommonName)
+	})
+	srv, err := r.tlsServer("", certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, srv, true)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{newTestCert(t, "alice", 3, ca).tlsCertificate()},
+	}}}
+	if _, body := get(t, client, "https://"+addr+"/whoami"); body != "alice" {
+		t.Fatalf("expect client subject alice, got %q", body)
+	}
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if _, err := anonymous.Get("https://" + addr + "/whoami"); err == nil {
+		t.Fatal("request without client certificate should be rejected")
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := newTestCert(t, "bee-ca", 1, nil)
+	newTestCert(t, "server", 2, ca).write(t, certFile, keyFile)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTestCert(t, "server", 42, ca).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	reloader.checked = time.Time{}
+
+	cert, _ := reloader.GetCertificate(nil)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.SerialNumber.Int64() != 42 {
+		t.Fatalf("expect reloaded certificate serial 42, got %v", leaf.SerialNumber)
+	}
+
+	// a broken file keeps the previous certificate
+	_ = os.WriteFile(certFile, []byte("broken"), 0600)
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	reloader.checked = time.Time{}
+	if cert, _ := reloader.GetCertificate(nil); cert == nil {
+		t.Fatal("certificate lost after a failed reload")
+	}
+}
+
+func TestH2C(t *testing.T) {
+	r := New()
+	r.GET("/proto", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.Req.Proto)
+	})
+	addr := serve(t, r.h2cServer(""), false)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	if _, body := get(t, client, "http://"+addr+"/proto"); body != "HTTP/2.0" {
+		t.Fatalf("expect HTTP/2.0, got %q", body)
+	}
+	if _, body := get(t, http.DefaultClient, "http://"+addr+"/proto"); body != "HTTP/1.1" {
+		t.Fatalf("expect HTTP/1.1, got %q", body)
+	}
+}
@@ -2,21 +2,26 @@ package bee
 
 import "strings"
 
+// node of the routing trie, the tries are shared by the published route tables so a node is never
+// modified once inserted: the changes copy the nodes along their path(写时复制)
 type node struct {
 	pattern  string
 	part     string
 	children []*node
 	isWild   bool
+	// the route registered on the leaf
+	handler HandlerFunc
+	route   *Route
 }
 
-// matchChild 匹配第一个节点，用于插入
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
+// matchChild 匹配第一个节点，用于插入，返回其下标
+func (n *node) matchChild(part string) int {
+	for i, child := range n.children {
 		if child.part == part || child.isWild {
-			return child
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 // matchChildren 匹配所有的节点 用于查找
@@ -30,24 +35,42 @@ func (n *node) matchChildren(part string) []*node {
 	return nodes
 }
 
-// 构建trie tree
-func (n *node) insert(pattern string, parts []string, height int) {
+// insert 返回插入路由后的新树，只复制路径上的节点
+func (n *node) insert(pattern string, parts []string, height int, handler HandlerFunc, route *Route) *node {
+	c := *n
 	//只有叶子结点pattern才不为空
 	if len(parts) == height {
-		n.pattern = pattern
-		return
+		c.pattern, c.handler, c.route = pattern, handler, route
+		return &c
 	}
 	part := parts[height]
+	c.children = append([]*node(nil), n.children...)
 	//查找第一个用于插入的节点位置
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{
+	i := n.matchChild(part)
+	if i < 0 {
+		c.children = append(c.children, &node{
 			part:   part,
 			isWild: part[0] == ':' || part[0] == '*',
+		})
+		i = len(c.children) - 1
+	}
+	c.children[i] = c.children[i].insert(pattern, parts, height+1, handler, route)
+	return &c
+}
+
+// lookup 返回注册了pattern的叶子结点
+func (n *node) lookup(pattern string, parts []string, height int) *node {
+	if len(parts) == height {
+		if n.pattern == pattern {
+			return n
 		}
-		n.children = append(n.children, child)
+		return nil
 	}
-	child.insert(pattern, parts, height+1)
+	i := n.matchChild(parts[height])
+	if i < 0 {
+		return nil
+	}
+	return n.children[i].lookup(pattern, parts, height+1)
 }
 
 func (n *node) search(parts []string, height int) *node {
@@ -70,3 +93,60 @@ func (n *node) search(parts []string, height int) *node {
 	}
 	return nil
 }
+
+// remove 返回删除pattern对应的叶子结点后的新树，并裁剪不再有路由的分支；没有这个路由时返回nil
+func (n *node) remove(pattern string, parts []string, height int) *node {
+	if len(parts) == height {
+		if n.pattern != pattern {
+			return nil
+		}
+		c := *n
+		c.pattern, c.handler, c.route = "", nil, nil
+		return &c
+	}
+	i := n.matchChild(parts[height])
+	if i < 0 {
+		return nil
+	}
+	child := n.children[i].remove(pattern, parts, height+1)
+	if child == nil {
+		return nil
+	}
+	c := *n
+	if child.pattern == "" && len(child.children) == 0 {
+		c.children = append(n.children[:i:i], n.children[i+1:]...)
+	} else {
+		c.children = append([]*node(nil), n.children...)
+		c.children[i] = child
+	}
+	return &c
+}
+
+// travel 收集所有注册了路由的节点
+func (n *node) travel(list *[]*node) {
+	if n.pattern != "" {
+		*list = append(*list, n)
+	}
+	for _, child := range n.children {
+		child.travel(list)
+	}
+}
+
+// searchFold 与search相同，但静态部分忽略大小写匹配
+func (n *node) searchFold(parts []string, height int) *node {
+	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+		if n.pattern == "" {
+			return nil
+		}
+		return n
+	}
+	part := parts[height]
+	for _, child := range n.children {
+		if child.isWild || strings.EqualFold(child.part, part) {
+			if result := child.searchFold(parts, height+1); result != nil {
+				return result
+			}
+		}
+	}
+	return nil
+}
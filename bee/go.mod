@@ -1,6 +1,6 @@
 module github.com/blkcor/bee-framework
 
-go 1.22
+go 1.24
 
 require bee v0.0.0
 
@@ -0,0 +1,259 @@
+// Package arc implements the Adaptive Replacement Cache, sized in bytes.
+//
+// Entries seen once live in t1, entries seen twice or more in t2. The keys recently evicted from them are
+// remembered in the ghost lists b1 and b2: a miss hitting b1 means t1 is too small, so its target p grows,
+// a miss hitting b2 shrinks it. A scan only goes through t1 and can't flush the frequently used entries of t2.
+package arc
+
+import (
+	"beeCache/policy"
+	"container/list"
+	"time"
+)
+
+type Value = policy.Value
+
+// Cache is an ARC cache
+type Cache struct {
+	maxBytes int64
+	p        int64 // target size of t1
+	t1, t2   *segment
+	b1, b2   *segment // ghosts, their entries have no value
+	cache    map[string]*list.Element
+	ghosts   map[string]*list.Element
+	expiries policy.Expiries
+	// OnEvicted is called when an entry is evicted to make room
+	OnEvicted func(key string, value Value)
+	// OnExpired is called when an expired entry is removed
+	OnExpired func(key string, value Value)
+	// Now is the clock deciding the expiration, time.Now by default
+	Now func() time.Time
+}
+
+// segment is a LRU list with its size, the most recently used at front
+type segment struct {
+	ll     *list.List
+	nBytes int64
+}
+
+type item struct {
+	*policy.Entry
+	size int64 // size of the entry when it became a ghost
+	seg  *segment
+}
+
+func newSegment() *segment {
+	return &segment{ll: list.New()}
+}
+
+func (s *segment) pushFront(it *item, size int64) *list.Element {
+	it.seg = s
+	s.nBytes += size
+	return s.ll.PushFront(it)
+}
+
+func (s *segment) remove(ele *list.Element, size int64) {
+	s.ll.Remove(ele)
+	s.nBytes -= size
+}
+
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        newSegment(),
+		t2:        newSegment(),
+		b1:        newSegment(),
+		b2:        newSegment(),
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+		Now:       time.Now,
+	}
+}
+
+// NewPolicy creates a Cache as a policy.Policy
+func NewPolicy(opts policy.Options) policy.Policy {
+	c := New(opts.MaxBytes, opts.OnEvicted)
+	c.OnExpired = opts.OnExpired
+	if opts.Now != nil {
+		c.Now = opts.Now
+	}
+	return c
+}
+
+// Get returns the value, an entry of t1 is promoted to t2. An expired entry is removed
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	it := ele.Value.(*item)
+	if it.Expired(c.Now()) {
+		c.removeElement(ele)
+		if c.OnExpired != nil {
+			c.OnExpired(it.Key, it.Value)
+		}
+		return nil, false
+	}
+	c.promote(ele)
+	return it.Value, true
+}
+
+// promote moves the entry to the front of t2
+func (c *Cache) promote(ele *list.Element) {
+	it := ele.Value.(*item)
+	if it.seg == c.t2 {
+		c.t2.ll.MoveToFront(ele)
+		return
+	}
+	it.seg.remove(ele, it.Size())
+	c.cache[it.Key] = c.t2.pushFront(it, it.Size())
+}
+
+// Peek returns the entry without recording the access, an expired entry is returned as is
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*item)
+		return e.Value, e.Expire, true
+	}
+	return
+}
+
+// Add adds an entry which never expires
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds an entry expiring at expire, updating an entry counts as an access
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		it := ele.Value.(*item)
+		it.seg.nBytes += int64(value.Len()) - int64(it.Value.Len())
+		it.Value = value
+		c.expiries.Set(it.Entry, expire)
+		c.promote(ele)
+		c.replace(false)
+		return
+	}
+	it := &item{Entry: policy.NewEntry(key, value)}
+	size := it.Size()
+	inB2 := false
+	if ghost, ok := c.ghosts[key]; ok {
+		g := ghost.Value.(*item)
+		// adapt the target of t1 to the ghost list hit, in proportion of the size of the other ghost list
+		if g.seg == c.b1 {
+			delta := size
+			if c.b1.nBytes > 0 && c.b2.nBytes > c.b1.nBytes {
+				delta = size * c.b2.nBytes / c.b1.nBytes
+			}
+			c.p = min(c.maxBytes, c.p+delta)
+		} else {
+			inB2 = true
+			delta := size
+			if c.b2.nBytes > 0 && c.b1.nBytes > c.b2.nBytes {
+				delta = size * c.b1.nBytes / c.b2.nBytes
+			}
+			c.p = max(0, c.p-delta)
+		}
+		c.removeGhost(ghost)
+		c.cache[key] = c.t2.pushFront(it, size)
+	} else {
+		c.cache[key] = c.t1.pushFront(it, size)
+	}
+	c.expiries.Set(it.Entry, expire)
+	c.replace(inB2)
+	c.trimGhosts()
+}
+
+// replace evicts entries until the cache fits, from t1 if it's above its target otherwise from t2
+func (c *Cache) replace(inB2 bool) {
+	for c.maxBytes != 0 && c.t1.nBytes+c.t2.nBytes > c.maxBytes {
+		var ele *list.Element
+		if c.t1.ll.Len() > 0 && (c.t1.nBytes > c.p || (inB2 && c.t1.nBytes == c.p) || c.t2.ll.Len() == 0) {
+			ele = c.t1.ll.Back()
+		} else {
+			ele = c.t2.ll.Back()
+		}
+		it := ele.Value.(*item)
+		ghosts := c.b1
+		if it.seg == c.t2 {
+			ghosts = c.b2
+		}
+		c.removeElement(ele)
+		c.ghosts[it.Key] = ghosts.pushFront(&item{Entry: &policy.Entry{Key: it.Key}, size: it.Size()}, it.Size())
+		if c.OnEvicted != nil {
+			c.OnEvicted(it.Key, it.Value)
+		}
+	}
+}
+
+// trimGhosts keeps t1+b1 and t2+b2 within maxBytes each
+func (c *Cache) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.b1.ll.Len() > 0 && c.t1.nBytes+c.b1.nBytes > c.maxBytes {
+		c.removeGhost(c.b1.ll.Back())
+	}
+	for c.b2.ll.Len() > 0 && c.t2.nBytes+c.b2.nBytes > c.maxBytes {
+		c.removeGhost(c.b2.ll.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*item)
+	g.seg.remove(ele, g.size)
+	delete(c.ghosts, g.Key)
+}
+
+// Range calls fn for the entries of t1 then of t2, each one from the least recently used, until it returns false
+func (c *Cache) Range(fn func(e *policy.Entry) bool) {
+	for _, s := range []*segment{c.t1, c.t2} {
+		for ele := s.ll.Back(); ele != nil; ele = ele.Prev() {
+			if !fn(ele.Value.(*item).Entry) {
+				return
+			}
+		}
+	}
+}
+
+// Remove removes the key, no callback is called
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes at most limit expired entries, it returns how many were removed
+func (c *Cache) RemoveExpired(limit int) int {
+	n := 0
+	for ; n < limit; n++ {
+		e, ok := c.expiries.Expired(c.Now())
+		if !ok {
+			break
+		}
+		c.removeElement(c.cache[e.Key])
+		if c.OnExpired != nil {
+			c.OnExpired(e.Key, e.Value)
+		}
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	it := ele.Value.(*item)
+	it.seg.remove(ele, it.Size())
+	delete(c.cache, it.Key)
+	c.expiries.Remove(it.Entry)
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the size of the keys and values
+func (c *Cache) Bytes() int64 {
+	return c.t1.nBytes + c.t2.nBytes
+}
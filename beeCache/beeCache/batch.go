@@ -0,0 +1,368 @@
+package beeCache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "github.com/blkcor/beeCache/proto"
+	"github.com/blkcor/beeCache/singleFlight"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BatchGetter is a Getter loading several keys at once, eg. with one query. It returns a value and an error
+// for each key, errs may be nil if all of them were found. GetMany uses it for the keys owned by this peer.
+type BatchGetter interface {
+	Getter
+	GetMany(ctx context.Context, keys []string) (values [][]byte, errs []error)
+}
+
+// BatchTTLGetter is a BatchGetter deciding how long each value lives like a TTLGetter,
+// ttls may be nil if all of them live the default ttl of the Group
+type BatchTTLGetter interface {
+	BatchGetter
+	GetManyWithTTL(ctx context.Context, keys []string) (values [][]byte, ttls []time.Duration, errs []error)
+}
+
+// Result is the value or the error of a key of GetMany
+type Result struct {
+	Key   string
+	Value ByteView
+	Err   error
+}
+
+// GetMany gets the keys with one request per peer: the hits are served from the cache, the misses owned by
+// a peer are asked to it in a batch and the ones owned by this peer are loaded, with the BatchGetter if there's one.
+// Like Get, the keys a peer failed to get are asked to their next replica, then loaded locally.
+// The results are in the order of the keys.
+func (g *Group) GetMany(ctx context.Context, keys []string) []Result {
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	found := make(map[string]Result, len(keys))
+	var local, remote []string
+	replicas := make(map[string][]PeerGetter)
+	for _, key := range keys {
+		if _, ok := found[key]; ok {
+			continue
+		}
+		if key == "" {
+			found[key] = Result{Key: key, Err: errors.New("key is required")}
+			continue
+		}
+		g.stats.gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			found[key] = Result{Key: key, Value: v}
+			continue
+		}
+		g.stats.loads.Add(1)
+		// 占位，防止重复的key
+		found[key] = Result{Key: key}
+		if peers, self := g.owners(key); !self {
+			replicas[key] = peers
+			remote = append(remote, key)
+		} else {
+			local = append(local, key)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	save := func(results []Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range results {
+			found[r.Key] = r
+		}
+	}
+	loadLocally := func(keys []string) {
+		if len(keys) == 0 {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			save(g.getManyLocally(ctx, g.loader, keys))
+		}()
+	}
+	loadLocally(local)
+	// 依次尝试每个副本，都失败后再从本地加载
+	for i := 0; len(remote) > 0; i++ {
+		if ctx.Err() != nil {
+			for _, key := range remote {
+				save([]Result{{Key: key, Err: ctx.Err()}})
+			}
+			break
+		}
+		batches := make(map[PeerGetter][]string)
+		var exhausted []string
+		for _, key := range remote {
+			if peers := replicas[key]; i < len(peers) {
+				batches[peers[i]] = append(batches[peers[i]], key)
+			} else {
+				exhausted = append(exhausted, key)
+			}
+		}
+		loadLocally(exhausted)
+		remote = g.getManyFromPeers(ctx, batches, save)
+	}
+	wg.Wait()
+
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		results[i] = found[key]
+	}
+	return results
+}
+
+// getManyFromPeers sends the batches to the peers concurrently, saves the results and returns the keys which failed
+func (g *Group) getManyFromPeers(ctx context.Context, batches map[PeerGetter][]string, save func([]Result)) []string {
+	var mu sync.Mutex
+	var failed []string
+	var wg sync.WaitGroup
+	for peer, keys := range batches {
+		wg.Add(1)
+		go func(peer PeerGetter, keys []string) {
+			defer wg.Done()
+			results, err := g.getManyFromPeer(ctx, peer, keys)
+			if err != nil && ctx.Err() == nil {
+				log.Println("[BeeCache] Failed to get many from peer:", err)
+			}
+			save(results)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range results {
+				if r.Err != nil {
+					failed = append(failed, r.Key)
+				}
+			}
+		}(peer, keys)
+	}
+	wg.Wait()
+	return failed
+}
+
+// getManyFromPeer asks the keys to their owner, a key it failed to get has an error
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string) ([]Result, error) {
+	batch, ok := peer.(BatchPeerGetter)
+	if !ok {
+		return g.getEachFromPeer(ctx, peer, keys), nil
+	}
+	res := &pb.BatchResponse{}
+	if err := batch.GetMany(ctx, &pb.BatchRequest{Group: g.name, Keys: keys}, res); err != nil {
+		g.stats.peerErrors.Add(int64(len(keys)))
+		results := make([]Result, len(keys))
+		for i, key := range keys {
+			results[i] = Result{Key: key, Err: err}
+		}
+		return results, err
+	}
+	answered := make(map[string]*pb.BatchResult, len(res.Results))
+	for _, r := range res.Results {
+		answered[r.Key] = r
+	}
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		r, ok := answered[key]
+		switch {
+		case !ok:
+			results[i] = Result{Key: key, Err: fmt.Errorf("%s missing from peer response", key)}
+		case r.Error != "":
+			results[i] = Result{Key: key, Err: errors.New(r.Error)}
+		default:
+			value := ByteView{b: r.Value, e: g.expire(peerTTL(r.TtlMillis))}
+			if g.hotRate > 0 && rand.Intn(g.hotRate) == 0 {
+				g.hotCache.add(key, value, value.e)
+			}
+			results[i] = Result{Key: key, Value: value}
+		}
+		if results[i].Err != nil {
+			g.stats.peerErrors.Add(1)
+		} else {
+			g.stats.peerLoads.Add(1)
+		}
+	}
+	return results, nil
+}
+
+// getEachFromPeer asks the keys one by one to a peer without GetMany
+func (g *Group) getEachFromPeer(ctx context.Context, peer PeerGetter, keys []string) []Result {
+	results := make([]Result, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			v, err := g.getFromPeer(ctx, peer, key)
+			if err != nil {
+				g.stats.peerErrors.Add(1)
+			} else {
+				g.stats.peerLoads.Add(1)
+			}
+			results[i] = Result{Key: key, Value: v, Err: err}
+		}(i, key)
+	}
+	wg.Wait()
+	return results
+}
+
+// getManyLocally loads the keys from the BatchGetter if there's one, otherwise it loads them concurrently.
+// The loads are deduped by loader, g.peerLoader for the keys asked by a peer: the keys already loading
+// wait for their load and the Gets of the keys in the batch wait for it.
+func (g *Group) getManyLocally(ctx context.Context, loader *singleFlight.Group, keys []string) []Result {
+	results := make([]Result, len(keys))
+	getter, ok := g.getter.(BatchGetter)
+	if !ok {
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			wg.Add(1)
+			go func(i int, key string) {
+				defer wg.Done()
+				v, err, _ := loader.DoContext(ctx, key, func() (interface{}, error) {
+					g.stats.loadsDeduped.Add(1)
+					ctx, cancel := loadContext(ctx)
+					defer cancel()
+					return g.getLocally(ctx, key)
+				})
+				results[i] = Result{Key: key, Err: err}
+				if err == nil {
+					results[i].Value = v.(ByteView)
+				}
+			}(i, key)
+		}
+		wg.Wait()
+		return results
+	}
+
+	// 没有在加载的key由这次批量加载，其余的等待正在进行的加载
+	var led []string
+	dones := make(map[string]func(interface{}, error))
+	waits := make([]<-chan singleFlight.Result, len(keys))
+	for i, key := range keys {
+		if done, ok := loader.Lead(key); ok {
+			led = append(led, key)
+			dones[key] = done
+			continue
+		}
+		waits[i] = loader.DoChan(key, func() (interface{}, error) {
+			ctx, cancel := loadContext(ctx)
+			defer cancel()
+			r := g.loadBatch(ctx, getter, []string{key})[0]
+			return r.Value, r.Err
+		})
+	}
+	loaded := make(map[string]Result, len(led))
+	if len(led) > 0 {
+		func() {
+			// 批量加载 panic 时也要唤醒等待的调用，已经给出结果的 done 不再生效
+			defer func() {
+				for _, done := range dones {
+					done(nil, errors.New("batch load aborted"))
+				}
+			}()
+			ctx, cancel := loadContext(ctx)
+			defer cancel()
+			for _, r := range g.loadBatch(ctx, getter, led) {
+				loaded[r.Key] = r
+				dones[r.Key](r.Value, r.Err)
+			}
+		}()
+	}
+	for i, key := range keys {
+		if waits[i] == nil {
+			results[i] = loaded[key]
+			continue
+		}
+		select {
+		case r := <-waits[i]:
+			results[i] = Result{Key: key, Err: r.Err}
+			if r.Err == nil {
+				results[i].Value = r.Val.(ByteView)
+			}
+		case <-ctx.Done():
+			results[i] = Result{Key: key, Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// loadBatch loads the keys with the BatchGetter and caches the values for their ttl
+func (g *Group) loadBatch(ctx context.Context, getter BatchGetter, keys []string) []Result {
+	g.stats.loadsDeduped.Add(int64(len(keys)))
+	var values [][]byte
+	var ttls []time.Duration
+	var errs []error
+	if withTTL, ok := getter.(BatchTTLGetter); ok {
+		values, ttls, errs = withTTL.GetManyWithTTL(ctx, keys)
+	} else {
+		values, errs = getter.GetMany(ctx, keys)
+	}
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		switch {
+		case i < len(errs) && errs[i] != nil:
+			results[i].Err = errs[i]
+		case i < len(values):
+			var ttl time.Duration
+			if i < len(ttls) {
+				ttl = ttls[i]
+			}
+			results[i].Value = g.populateCache(key, ByteView{b: cloneBytes(values[i])}, ttl)
+		default:
+			results[i].Err = errors.New("batch getter returned no value")
+		}
+		if results[i].Err != nil {
+			g.stats.localLoadErrs.Add(1)
+		} else {
+			g.stats.localLoads.Add(1)
+		}
+	}
+	return results
+}
+
+// getManyForPeer serves the batch of a peer, like getForPeer the keys are never forwarded
+func (g *Group) getManyForPeer(ctx context.Context, keys []string) []Result {
+	results := make([]Result, len(keys))
+	var misses []string
+	g.stats.gets.Add(int64(len(keys)))
+	g.stats.serverRequests.Add(int64(len(keys)))
+	for i, key := range keys {
+		results[i].Key = key
+		if v, ok := g.lookupCache(key); ok {
+			results[i].Value = v
+		} else {
+			misses = append(misses, key)
+		}
+	}
+	g.stats.loads.Add(int64(len(misses)))
+	if len(misses) == 0 {
+		return results
+	}
+	loaded := make(map[string]Result, len(misses))
+	for _, r := range g.getManyLocally(ctx, g.peerLoader, misses) {
+		loaded[r.Key] = r
+	}
+	for i, key := range keys {
+		if r, ok := loaded[key]; ok {
+			results[i] = r
+		}
+	}
+	return results
+}
+
+// batchResponse encodes the results of getManyForPeer
+func (g *Group) batchResponse(results []Result) *pb.BatchResponse {
+	out := &pb.BatchResponse{}
+	for _, r := range results {
+		result := &pb.BatchResult{Key: r.Key, Value: r.Value.ByteSlice()}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+		} else {
+			result.TtlMillis = g.ttlLeftMillis(r.Value)
+		}
+		out.Results = append(out.Results, result)
+	}
+	return out
+}
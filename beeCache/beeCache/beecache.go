@@ -1,11 +1,16 @@
 package beeCache
 
 import (
+	"beeCache/policy"
+	"context"
+	"errors"
 	"fmt"
 	pb "github.com/blkcor/beeCache/proto"
 	"github.com/blkcor/beeCache/singleFlight"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 // Getter loads the data from a key
@@ -19,13 +24,151 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter is a Getter deciding how long each value lives,
+// a ttl of 0 means the default ttl of the Group and a negative one means never expire
+type TTLGetter interface {
+	Getter
+	GetWithTTL(key string) (value []byte, ttl time.Duration, err error)
+}
+
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// GetterWithContext is a Getter giving up once ctx is done. The Getters without context keep working,
+// a Group calls GetContext rather than Get if its Getter has it.
+type GetterWithContext interface {
+	Getter
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+type GetterWithContextFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get calls f with context.Background()
+func (f GetterWithContextFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+func (f GetterWithContextFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// TTLGetterWithContext is a TTLGetter giving up once ctx is done
+type TTLGetterWithContext interface {
+	TTLGetter
+	GetWithTTLContext(ctx context.Context, key string) (value []byte, ttl time.Duration, err error)
+}
+
+type TTLGetterWithContextFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterWithContextFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(context.Background(), key)
+	return b, err
+}
+
+func (f TTLGetterWithContextFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(context.Background(), key)
+}
+
+func (f TTLGetterWithContextFunc) GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
 // A Group is a cache namespace and associated data loaded spread over
 type Group struct {
 	name      string
 	getter    Getter
 	mainCache cache
-	peers     PeerPicker
-	loader    *singleFlight.Group
+	// hotCache holds a sample of the keys owned by other peers, so a key hit from everywhere doesn't
+	// send all the traffic to its owner
+	hotCache        cache
+	hotRate         int // 1 out of hotRate values got from a peer is kept in hotCache, 0 disables it
+	peers           PeerPicker
+	loader          *singleFlight.Group
+	peerLoader      *singleFlight.Group // dedups the loads asked by the peers apart, see getForPeer
+	stats           groupStats
+	ttl             time.Duration // 0 means the entries never expire
+	timeout         time.Duration // bounds the Gets without deadline, 0 means no limit
+	now             func() time.Time
+	stop            chan struct{} // stops the janitor and the snapshotter
+	janitorInterval time.Duration
+	closeOnce       sync.Once
+	// snapshotPath is where the snapshotter saves the main cache every snapshotInterval, nowhere if it's empty
+	snapshotPath     string
+	snapshotInterval time.Duration
+	snapshotDone     chan struct{} // closed once the last snapshot is saved
+}
+
+const defaultHotRate = 10
+
+// Option configures a Group
+type Option func(g *Group)
+
+// WithTTL sets the default time to live of the entries
+func WithTTL(ttl time.Duration) Option {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithTimeout bounds the Gets whose context has no deadline, eg. the ones of Get
+func WithTimeout(timeout time.Duration) Option {
+	return func(g *Group) {
+		g.timeout = timeout
+	}
+}
+
+// WithClock sets the clock deciding the expiration, time.Now by default
+func WithClock(now func() time.Time) Option {
+	return func(g *Group) {
+		g.now = now
+		g.mainCache.now = now
+	}
+}
+
+// WithPolicy sets the eviction policy of the cache, eg. lfu.NewPolicy, LRU by default
+func WithPolicy(newPolicy policy.Factory) Option {
+	return func(g *Group) {
+		g.mainCache.newPolicy = newPolicy
+	}
+}
+
+// WithJanitor reclaims the expired entries every interval, otherwise they're only dropped when read or evicted
+func WithJanitor(interval time.Duration) Option {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithHotCache sets the size of the hot cache and keeps 1 out of rate values got from peers in it.
+// A rate of 0 disables it, by default it's 1/8 of the main cache and keeps 1 out of 10 values.
+func WithHotCache(cacheBytes int64, rate int) Option {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = cacheBytes
+		g.hotRate = rate
+	}
+}
+
+// WithShards splits the cache into n shards, each one with its own lock and cacheBytes/n bytes
+func WithShards(n int) Option {
+	return func(g *Group) {
+		g.mainCache.shardCount = n
+	}
+}
+
+// WithReadSampling serves the hits under a shared lock and only records 1 out of n of them in the eviction policy.
+// Concurrent reads of hot keys no longer contend, at the cost of a less precise eviction.
+func WithReadSampling(n int) Option {
+	return func(g *Group) {
+		g.mainCache.sampling = n
+	}
 }
 
 var (
@@ -34,17 +177,40 @@ var (
 )
 
 // NewGroup create a new instance of group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...Option) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleFlight.Group{},
+		name:       name,
+		getter:     getter,
+		mainCache:  cache{cacheBytes: cacheBytes},
+		hotCache:   cache{cacheBytes: cacheBytes / 8},
+		hotRate:    defaultHotRate,
+		loader:     &singleFlight.Group{},
+		peerLoader: &singleFlight.Group{},
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.hotCache.now = g.mainCache.now
+	g.hotCache.shardCount = g.mainCache.shardCount
+	g.hotCache.sampling = g.mainCache.sampling
+	if g.janitorInterval > 0 || g.snapshotPath != "" {
+		g.stop = make(chan struct{})
+	}
+	if g.janitorInterval > 0 {
+		go g.mainCache.janitor(g.janitorInterval, g.stop)
+		if g.hotRate > 0 {
+			go g.hotCache.janitor(g.janitorInterval, g.stop)
+		}
+	}
+	if g.snapshotPath != "" {
+		g.snapshotDone = make(chan struct{})
+		go g.snapshotter(g.snapshotInterval, g.stop, g.snapshotDone)
 	}
 	groups[name] = g
 	return g
@@ -58,6 +224,40 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
+// Close stops the janitor of the group, with WithSnapshot it returns once the last snapshot is saved
+func (g *Group) Close() {
+	g.closeOnce.Do(func() {
+		if g.stop != nil {
+			close(g.stop)
+		}
+		if g.snapshotDone != nil {
+			<-g.snapshotDone
+		}
+	})
+}
+
+// CacheType selects a cache of a Group
+type CacheType int
+
+const (
+	// MainCache holds the keys owned by this peer
+	MainCache CacheType = iota + 1
+	// HotCache holds the popular keys owned by other peers
+	HotCache
+)
+
+// CacheStats returns the statistics of a cache of the group
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
@@ -67,32 +267,83 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Get gets the key with context.Background(), bounded by WithTimeout if set
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext gets the value of the key from the cache, its owner or the Getter.
+// It returns ctx.Err() once ctx is done, the load keeps running for the other callers of the key.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.stats.gets.Add(1)
 	//如果缓存命中
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[BeeCache] hit")
+	if v, ok := g.lookupCache(key); ok {
 		return v, nil
 	}
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
 	//否则 去数据源加载数据并存入缓存
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+func (g *Group) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || g.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+// loadContext is the context of a load shared by several callers: one of them giving up doesn't cancel it
+// for the others, but the deadline of the first caller still bounds it
+func loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return detached, func() {}
+}
+
+// lookupCache looks for the key in the main cache then in the hot cache
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	v, ok := g.mainCache.get(key)
+	if !ok && g.hotRate > 0 {
+		v, ok = g.hotCache.get(key)
+	}
+	if ok {
+		g.stats.hits.Add(1)
+	} else {
+		g.stats.misses.Add(1)
+	}
+	return v, ok
 }
 
 // load loads data for a key
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.stats.loads.Add(1)
 	// loader 保证并发场景下对每个key只调用一次fn(防止缓存击穿)
-	view, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if v, err := g.getFromPeer(peer, key); err == nil {
+	view, err, _ := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		g.stats.loadsDeduped.Add(1)
+		ctx, cancel := loadContext(ctx)
+		defer cancel()
+		// 依次尝试每个副本，都失败后再从本地加载
+		if peers, self := g.owners(key); !self {
+			for _, peer := range peers {
+				v, err := g.getFromPeer(ctx, peer, key)
+				if err == nil {
+					g.stats.peerLoads.Add(1)
 					return v, nil
 				}
+				g.stats.peerErrors.Add(1)
+				if ctx.Err() != nil {
+					return nil, err
+				}
 				log.Println("[BeeCache] Failed to get from peer")
 			}
 		}
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
 	if err == nil {
 		return view.(ByteView), nil
@@ -100,31 +351,254 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// getForPeer serves the request of a peer, the key is never forwarded to another one:
+// while the peers change two of them may both think the other owns it. The load is deduped by peerLoader,
+// the one of loader may be waiting for the peer and the two peers would wait for each other.
+func (g *Group) getForPeer(ctx context.Context, key string) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, fmt.Errorf("key is required")
+	}
+	g.stats.gets.Add(1)
+	g.stats.serverRequests.Add(1)
+	if v, ok := g.lookupCache(key); ok {
+		return v, nil
+	}
+	g.stats.loads.Add(1)
+	view, err, _ := g.peerLoader.DoContext(ctx, key, func() (interface{}, error) {
+		g.stats.loadsDeduped.Add(1)
+		ctx, cancel := loadContext(ctx)
+		defer cancel()
+		return g.getLocally(ctx, key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	var err error
+	if withContext, ok := peer.(PeerGetterWithContext); ok {
+		err = withContext.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	value := ByteView{b: res.Value, e: g.expire(peerTTL(res.TtlMillis))}
+	if g.hotRate > 0 && rand.Intn(g.hotRate) == 0 {
+		g.hotCache.add(key, value, value.e)
+	}
+	return value, nil
 }
 
 // getLocally get the data from local(in distributed scenes use getFromPeer func)
-func (g *Group) getLocally(key string) (ByteView, error) {
-	b, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var b []byte
+	var ttl time.Duration
+	var err error
+	switch getter := g.getter.(type) {
+	case TTLGetterWithContext:
+		b, ttl, err = getter.GetWithTTLContext(ctx, key)
+	case TTLGetter:
+		b, ttl, err = getter.GetWithTTL(key)
+	case GetterWithContext:
+		b, err = getter.GetContext(ctx, key)
+	default:
+		b, err = g.getter.Get(key)
+	}
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
 		return ByteView{}, err
 	}
+	g.stats.localLoads.Add(1)
 
-	value := ByteView{b: cloneBytes(b)}
-	g.populateCache(key, value)
-	return value, nil
+	return g.populateCache(key, ByteView{b: cloneBytes(b)}, ttl), nil
+}
+
+// populateCache stores the value for ttl, the default ttl of the group is used if it's 0.
+// It returns the value with its expiration.
+func (g *Group) populateCache(key string, value ByteView, ttl time.Duration) ByteView {
+	value.e = g.expire(ttl)
+	g.mainCache.add(key, value, value.e)
+	return value
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// Set stores the value on the owners of the key for ttl, the default ttl of the group is used if it's 0
+// and a negative one means never expire. The other peers drop the key from their hot cache.
+func (g *Group) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	peers, self := g.owners(key)
+	req := &pb.SetRequest{
+		Group:     g.name,
+		Key:       key,
+		Value:     value,
+		TtlMillis: ttlMillis(ttl),
+	}
+	err := g.eachPeer(peers, func(peer PeerGetter) error {
+		if err := writer(peer).Set(ctx, req, &pb.Response{}); err != nil {
+			return fmt.Errorf("set %s on its owner: %w", key, err)
+		}
+		return nil
+	})
+	if self {
+		g.setLocally(key, value, ttl)
+	} else {
+		g.mainCache.remove(key)
+	}
+	return errors.Join(err, g.broadcastInvalidate(ctx, key))
+}
+
+// Remove removes the key from its owners, the other peers drop it from their hot cache
+func (g *Group) Remove(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	peers, _ := g.owners(key)
+	err := g.eachPeer(peers, func(peer PeerGetter) error {
+		if err := writer(peer).Remove(ctx, &pb.Request{Group: g.name, Key: key}, &pb.Response{}); err != nil {
+			return fmt.Errorf("remove %s from its owner: %w", key, err)
+		}
+		return nil
+	})
+	g.removeLocally(key)
+	return errors.Join(err, g.broadcastInvalidate(ctx, key))
+}
+
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	return g.peers.PickPeer(key)
+}
+
+// owners returns the other peers holding the key, all its replicas if the PeerPicker is a ReplicaPicker,
+// and whether this peer holds it too
+func (g *Group) owners(key string) (peers []PeerGetter, self bool) {
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		return rp.PickReplicas(key)
+	}
+	if peer, ok := g.pickPeer(key); ok {
+		return []PeerGetter{peer}, false
+	}
+	return nil, true
+}
+
+// eachPeer calls fn for the peers concurrently and joins the errors
+func (g *Group) eachPeer(peers []PeerGetter, fn func(peer PeerGetter) error) error {
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer PeerGetter) {
+			defer wg.Done()
+			errs[i] = fn(peer)
+		}(i, peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// writer returns the peer as a PeerWriter, a peer without writes fails them
+func writer(peer PeerGetter) PeerWriter {
+	if w, ok := peer.(PeerWriter); ok {
+		return w
+	}
+	return readOnlyPeer{peer}
+}
+
+type readOnlyPeer struct {
+	PeerGetter
+}
+
+func (p readOnlyPeer) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	return fmt.Errorf("peer %T doesn't support writes", p.PeerGetter)
+}
+
+func (p readOnlyPeer) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("peer %T doesn't support writes", p.PeerGetter)
+}
+
+func (p readOnlyPeer) Invalidate(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("peer %T doesn't support writes", p.PeerGetter)
+}
+
+// setLocally stores the value in the main cache, it's called on the owner of the key
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) {
+	// the loads in flight read the previous value, the next Get doesn't wait for them
+	g.loader.Forget(key)
+	g.populateCache(key, ByteView{b: cloneBytes(value)}, ttl)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) removeLocally(key string) {
+	g.loader.Forget(key)
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+// invalidate drops the key from the hot cache. A key loaded locally while its owner was unreachable
+// is dropped from the main cache too, only the owner keeps it.
+func (g *Group) invalidate(key string) {
+	g.hotCache.remove(key)
+	if _, ok := g.pickPeer(key); ok {
+		g.mainCache.remove(key)
+	}
+}
+
+// broadcastInvalidate invalidates the key locally and on all the other peers concurrently if the PeerPicker lists them
+func (g *Group) broadcastInvalidate(ctx context.Context, key string) error {
+	g.hotCache.remove(key)
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	return g.eachPeer(lister.Peers(), func(peer PeerGetter) error {
+		if err := writer(peer).Invalidate(ctx, &pb.Request{Group: g.name, Key: key}, &pb.Response{}); err != nil {
+			return fmt.Errorf("invalidate %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// ttlMillis encodes ttl for a SetRequest: a negative ttl is sent as -1 and a positive one is rounded
+// up to the millisecond, so neither becomes 0, the default ttl of the group
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// ttlLeftMillis encodes the time left before the value expires like ttlMillis, so the peers caching it
+// don't keep it longer than its owner
+func (g *Group) ttlLeftMillis(v ByteView) int64 {
+	if v.e.IsZero() {
+		return -1
+	}
+	return max(ttlMillis(v.e.Sub(g.now())), 1)
+}
+
+// peerTTL decodes the ttl_millis sent by a peer, 0 stays the default ttl of the group
+func peerTTL(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// expire returns the expiration of an entry living ttl, the default ttl of the group is used if it's 0
+func (g *Group) expire(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return g.now().Add(ttl)
 }
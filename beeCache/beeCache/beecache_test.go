@@ -1,10 +1,18 @@
 package beeCache
 
 import (
+	"beeCache/lfu"
+	"context"
+	"errors"
 	"fmt"
+	pb "github.com/blkcor/beeCache/proto"
 	"log"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -41,15 +49,629 @@ func TestGet(t *testing.T) {
 		}))
 
 	for k, v := range db {
-		if view, err := beeCache.Get(k); err != nil || view.String() != v {
+		if view, err := beeCache.GetContext(context.Background(), k); err != nil || view.String() != v {
 			t.Fatal("failed to get value of Tom")
 		} // load from callback function
-		if _, err := beeCache.Get(k); err != nil || loadCounts[k] > 1 {
+		if _, err := beeCache.GetContext(context.Background(), k); err != nil || loadCounts[k] > 1 {
 			t.Fatalf("cache %s miss", k)
 		} // cache hit
 	}
 
-	if view, err := beeCache.Get("unknown"); err == nil {
+	if view, err := beeCache.GetContext(context.Background(), "unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	loads := 0
+	g := NewGroup("ttl", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), time.Second, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+	defer g.Close()
+
+	for _, key := range []string{"short", "default", "short", "default"} {
+		if _, err := g.GetContext(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 2 {
+		t.Fatalf("expect 2 loads, got %d", loads)
+	}
+	now = now.Add(2 * time.Second)
+	g.GetContext(context.Background(), "short")
+	g.GetContext(context.Background(), "default")
+	if loads != 3 {
+		t.Fatalf("expect short reloaded, got %d loads", loads)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := g.mainCache.removeExpired(); n != 2 {
+		t.Fatalf("expect 2 entries reclaimed, got %d", n)
+	}
+	if stats := g.CacheStats(MainCache); stats.Expirations != 3 || stats.Items != 0 || stats.Bytes != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	g := NewGroup("janitor", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithTTL(time.Second), WithClock(clock), WithJanitor(time.Millisecond))
+	defer g.Close()
+	g.GetContext(context.Background(), "key")
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	deadline := time.After(time.Second)
+	for g.CacheStats(MainCache).Items != 0 {
+		select {
+		case <-deadline:
+			t.Fatal("the janitor didn't reclaim the expired entry")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	g := NewGroup("lfu", 8, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithPolicy(lfu.NewPolicy))
+	// k1 is used often, k2 and k3 once, so k2 is evicted by k3
+	for _, key := range []string{"k1", "k1", "k1", "k2", "k3"} {
+		g.GetContext(context.Background(), key)
+	}
+	if stats := g.CacheStats(MainCache); stats.Items != 2 || stats.Evictions != 1 || stats.Hits != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, ok := g.mainCache.get("k1"); !ok {
+		t.Fatal("k1 should stay cached")
+	}
+}
+
+// fakePeer owns all the keys unless local is set, it answers with the key and records the calls.
+// With old set it's picked as a PeerGetter without the other methods, with omit set its batches leave out the keys.
+// Its values live ttl milliseconds.
+type fakePeer struct {
+	mu            sync.Mutex
+	local         bool
+	old           bool
+	omit          bool
+	ttl           int64
+	calls         int
+	values        map[string][]byte
+	invalidations []string
+}
+
+func (p *fakePeer) PickPeer(key string) (PeerGetter, bool) {
+	if p.local {
+		return nil, false
+	}
+	return p.getter(), true
+}
+
+func (p *fakePeer) Peers() []PeerGetter {
+	return []PeerGetter{p.getter()}
+}
+
+func (p *fakePeer) getter() PeerGetter {
+	if p.old {
+		return oldPeer{p}
+	}
+	return p
+}
+
+type oldPeer struct {
+	p *fakePeer
+}
+
+func (o oldPeer) Get(in *pb.Request, out *pb.Response) error {
+	return o.p.Get(in, out)
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p *fakePeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	out.TtlMillis = p.ttl
+	if v, ok := p.values[in.Key]; ok {
+		out.Value = v
+		return nil
+	}
+	out.Value = []byte("remote " + in.Key)
+	return nil
+}
+
+func (p *fakePeer) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.omit {
+		return nil
+	}
+	for _, key := range in.Keys {
+		if strings.HasSuffix(key, "missing") {
+			out.Results = append(out.Results, &pb.BatchResult{Key: key, Error: key + " not exist"})
+			continue
+		}
+		out.Results = append(out.Results, &pb.BatchResult{Key: key, Value: []byte("remote " + key), TtlMillis: p.ttl})
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.values == nil {
+		p.values = make(map[string][]byte)
+	}
+	p.values[in.Key] = in.Value
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.values, in.Key)
+	return nil
+}
+
+func (p *fakePeer) Invalidate(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invalidations = append(p.invalidations, in.Key)
+	return nil
+}
+
+func TestHotCache(t *testing.T) {
+	g := NewGroup("hot", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}), WithHotCache(1<<10, 1))
+	peer := &fakePeer{}
+	g.RegisterPeers(peer)
+
+	for i := 0; i < 3; i++ {
+		if v, err := g.GetContext(context.Background(), "viral"); err != nil || v.String() != "remote viral" {
+			t.Fatalf("unexpected value %v %v", v, err)
+		}
+	}
+	if peer.calls != 1 {
+		t.Fatalf("expect the peer called once, got %d", peer.calls)
+	}
+	main, hot := g.CacheStats(MainCache), g.CacheStats(HotCache)
+	if main.Items != 0 || main.Hits != 0 || hot.Items != 1 || hot.Hits != 2 {
+		t.Fatalf("unexpected stats main %+v hot %+v", main, hot)
+	}
+
+	off := NewGroup("hot-off", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}), WithHotCache(0, 0))
+	peer = &fakePeer{}
+	off.RegisterPeers(peer)
+	off.GetContext(context.Background(), "viral")
+	off.GetContext(context.Background(), "viral")
+	if peer.calls != 2 {
+		t.Fatalf("expect the peer called twice, got %d", peer.calls)
+	}
+}
+
+func TestHotCacheTTL(t *testing.T) {
+	now := time.Now()
+	g := NewGroup("hot-ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}), WithTTL(time.Hour), WithHotCache(1<<10, 1), WithClock(func() time.Time { return now }))
+	peer := &fakePeer{ttl: 5000}
+	g.RegisterPeers(peer)
+
+	g.GetContext(context.Background(), "one")
+	g.GetMany(context.Background(), []string{"many"})
+	now = now.Add(4 * time.Second)
+	g.GetContext(context.Background(), "one")
+	g.GetMany(context.Background(), []string{"many"})
+	if peer.calls != 2 {
+		t.Fatalf("expect the hot copies used, got %d peer calls", peer.calls)
+	}
+	// the copies expire with the values of the owner, not after the ttl of the group
+	now = now.Add(time.Second)
+	g.GetContext(context.Background(), "one")
+	g.GetMany(context.Background(), []string{"many"})
+	if peer.calls != 4 {
+		t.Fatalf("expect the hot copies expired, got %d peer calls", peer.calls)
+	}
+}
+
+func TestTTLLeft(t *testing.T) {
+	now := time.Now()
+	g := NewGroup("ttl-left", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}), WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+
+	if v, _ := g.getForPeer(context.Background(), "k"); g.ttlLeftMillis(v) != 60000 {
+		t.Fatalf("expect 60000ms left, got %d", g.ttlLeftMillis(v))
+	}
+	now = now.Add(20 * time.Second)
+	if v, _ := g.getForPeer(context.Background(), "k"); g.ttlLeftMillis(v) != 40000 {
+		t.Fatalf("expect 40000ms left, got %d", g.ttlLeftMillis(v))
+	}
+	g.Set(context.Background(), "forever", []byte("v"), -1)
+	res := g.batchResponse(g.getManyForPeer(context.Background(), []string{"k", "forever"}))
+	if res.Results[0].TtlMillis != 40000 || res.Results[1].TtlMillis != -1 {
+		t.Fatalf("unexpected results %v", res.Results)
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	g := NewGroup("set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}), WithHotCache(1<<10, 1))
+	peer := &fakePeer{}
+	g.RegisterPeers(peer)
+
+	if v, _ := g.GetContext(context.Background(), "k"); v.String() != "remote k" {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if err := g.Set(context.Background(), "k", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(peer.values["k"]) != "v1" || !reflect.DeepEqual(peer.invalidations, []string{"k"}) {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+	// the stale value was dropped from the hot cache
+	if v, _ := g.GetContext(context.Background(), "k"); v.String() != "v1" {
+		t.Fatalf("expect v1, got %v", v)
+	}
+	if err := g.Remove(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := peer.values["k"]; ok || len(peer.invalidations) != 2 {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+	if g.CacheStats(HotCache).Items != 0 {
+		t.Fatal("k should be invalidated")
+	}
+}
+
+// pickerOnly is a PeerPicker which doesn't list its peers
+type pickerOnly struct {
+	p *fakePeer
+}
+
+func (p pickerOnly) PickPeer(key string) (PeerGetter, bool) {
+	return p.p.PickPeer(key)
+}
+
+func TestSetWithoutLister(t *testing.T) {
+	g := NewGroup("set-no-lister", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}))
+	peer := &fakePeer{}
+	g.RegisterPeers(pickerOnly{peer})
+
+	if err := g.Set(context.Background(), "k", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Remove(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := peer.values["k"]; ok || len(peer.invalidations) != 0 {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+}
+
+func TestSetLocally(t *testing.T) {
+	now := time.Now()
+	g := NewGroup("set-local", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("source"), nil
+	}), WithClock(func() time.Time { return now }))
+	peer := &fakePeer{local: true}
+	g.RegisterPeers(peer)
+
+	if err := g.Set(context.Background(), "k", []byte("v1"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.GetContext(context.Background(), "k"); v.String() != "v1" || len(peer.values) != 0 {
+		t.Fatalf("expect v1 stored locally, got %v", v)
+	}
+	now = now.Add(time.Second)
+	if v, _ := g.GetContext(context.Background(), "k"); v.String() != "source" {
+		t.Fatalf("expect k expired, got %v", v)
+	}
+	if err := g.Remove(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if g.CacheStats(MainCache).Items != 0 || !reflect.DeepEqual(peer.invalidations, []string{"k", "k"}) {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+}
+
+func TestTTLMillis(t *testing.T) {
+	for ttl, want := range map[time.Duration]int64{
+		0:                       0,
+		-1:                      -1,
+		-time.Hour:              -1,
+		time.Microsecond:        1,
+		1500 * time.Microsecond: 2,
+		time.Second:             1000,
+	} {
+		if got := ttlMillis(ttl); got != want {
+			t.Fatalf("ttlMillis(%v): expect %d, got %d", ttl, want, got)
+		}
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("slow", 2<<10, GetterWithContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		select {
+		case <-release:
+			return []byte(key), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the deadline exceeded, got %v", err)
+	}
+
+	// a caller giving up doesn't cancel the load of the others
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctx, "other")
+		done <- err
+	}()
+	result := make(chan ByteView, 1)
+	go func() {
+		v, _ := g.GetContext(context.Background(), "other")
+		result <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	close(release)
+	if v := <-result; v.String() != "other" {
+		t.Fatalf("expect other, got %v", v)
+	}
+}
+
+func TestGetWithoutContext(t *testing.T) {
+	g := NewGroup("compat", 2<<10, GetterWithContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), WithTimeout(10*time.Millisecond))
+	if _, err := g.Get("key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the timeout of the group, got %v", err)
+	}
+	// the Getters without context keep working
+	old := NewGroup("compat-getter", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	if v, err := old.Get("key"); err != nil || v.String() != "key" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+
+	// and so do the PeerGetters without context
+	remote := NewGroup("compat-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s is owned by the peer", key)
+	}), WithHotCache(0, 0))
+	remote.RegisterPeers(&fakePeer{old: true})
+	if v, err := remote.Get("key"); err != nil || v.String() != "remote key" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+	results := remote.GetMany(context.Background(), []string{"a", "b"})
+	if results[0].Value.String() != "remote a" || results[1].Value.String() != "remote b" {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if err := remote.Set(context.Background(), "key", []byte("v"), 0); err == nil {
+		t.Fatal("expect the write to fail on a peer without writes")
+	}
+}
+
+// batchDB is a BatchGetter counting its calls, the keys ending with missing don't exist
+type batchDB struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (db *batchDB) Get(key string) ([]byte, error) {
+	return nil, fmt.Errorf("%s should be loaded in a batch", key)
+}
+
+func (db *batchDB) GetMany(ctx context.Context, keys []string) ([][]byte, []error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.batches = append(db.batches, keys)
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		if strings.HasSuffix(key, "missing") {
+			errs[i] = fmt.Errorf("%s not exist", key)
+		} else {
+			values[i] = []byte("local " + key)
+		}
+	}
+	return values, errs
+}
+
+// prefixPicker gives the keys starting with r to the fake peer
+type prefixPicker struct {
+	*fakePeer
+}
+
+func (p prefixPicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.fakePeer, strings.HasPrefix(key, "r")
+}
+
+func TestGetMany(t *testing.T) {
+	db := &batchDB{}
+	g := NewGroup("many", 2<<10, db, WithHotCache(0, 0))
+	peer := &fakePeer{}
+	g.RegisterPeers(prefixPicker{peer})
+	g.mainCache.add("l0", ByteView{b: []byte("cached")}, time.Time{})
+
+	keys := []string{"l0", "l1", "r1", "lmissing", "r2", "rmissing", "l1", ""}
+	results := g.GetMany(context.Background(), keys)
+	want := []string{"cached", "local l1", "remote r1", "", "remote r2", "", "local l1", ""}
+	for i, r := range results {
+		if r.Key != keys[i] || r.Value.String() != want[i] || (r.Err != nil) != (want[i] == "") {
+			t.Fatalf("unexpected result %d %+v", i, r)
+		}
+	}
+	// like Get, the key the peer failed to get is loaded locally
+	sort.Slice(db.batches, func(i, j int) bool { return len(db.batches[i]) > len(db.batches[j]) })
+	if peer.calls != 1 || !reflect.DeepEqual(db.batches, [][]string{{"l1", "lmissing"}, {"rmissing"}}) {
+		t.Fatalf("expect one request per peer, got %d calls and batches %v", peer.calls, db.batches)
+	}
+
+	// the local keys are now hits
+	g.GetMany(context.Background(), []string{"l0", "l1"})
+	if len(db.batches) != 2 {
+		t.Fatalf("expect the local keys cached, got batches %v", db.batches)
+	}
+}
+
+// replicaPicker gives all the keys to its peers, in order
+type replicaPicker []PeerGetter
+
+func (p replicaPicker) PickPeer(key string) (PeerGetter, bool) {
+	return p[0], true
+}
+
+func (p replicaPicker) Peers() []PeerGetter {
+	return p
+}
+
+func (p replicaPicker) PickReplicas(key string) ([]PeerGetter, bool) {
+	return p, false
+}
+
+func TestGetManyReplicas(t *testing.T) {
+	g := NewGroup("many-replicas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local " + key), nil
+	}), WithHotCache(0, 0))
+	first, second := &fakePeer{omit: true}, &fakePeer{}
+	g.RegisterPeers(replicaPicker{first, second})
+
+	results, _ := g.getManyFromPeer(context.Background(), first, []string{"a"})
+	if results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "missing from peer response") {
+		t.Fatalf("expect the key missing from the response, got %+v", results[0])
+	}
+	// the keys omitted by the first replica are asked to the next one
+	results = g.GetMany(context.Background(), []string{"a", "b"})
+	if results[0].Value.String() != "remote a" || results[1].Value.String() != "remote b" || second.calls != 1 {
+		t.Fatalf("unexpected results %v after %d calls", results, second.calls)
+	}
+}
+
+// ttlBatchDB is a BatchTTLGetter whose values live a second, it waits for release
+type ttlBatchDB struct {
+	batchDB
+	started, release chan struct{}
+}
+
+func (db *ttlBatchDB) GetManyWithTTL(ctx context.Context, keys []string) ([][]byte, []time.Duration, []error) {
+	close(db.started)
+	<-db.release
+	values, errs := db.GetMany(ctx, keys)
+	ttls := make([]time.Duration, len(keys))
+	for i := range ttls {
+		ttls[i] = time.Second
+	}
+	return values, ttls, errs
+}
+
+func TestGetManyDedup(t *testing.T) {
+	now := time.Now()
+	db := &ttlBatchDB{started: make(chan struct{}), release: make(chan struct{})}
+	g := NewGroup("many-dedup", 2<<10, db, WithClock(func() time.Time { return now }))
+	many := make(chan []Result, 1)
+	go func() {
+		many <- g.GetMany(context.Background(), []string{"k"})
+	}()
+	<-db.started
+	// the Get of a key in the batch waits for it
+	get := make(chan ByteView, 1)
+	go func() {
+		v, _ := g.Get("k")
+		get <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(db.release)
+	if r := <-many; r[0].Value.String() != "local k" {
+		t.Fatalf("unexpected result %+v", r[0])
+	}
+	if v := <-get; v.String() != "local k" || len(db.batches) != 1 {
+		t.Fatalf("expect the Get to share the batch, got %v and batches %v", v, db.batches)
+	}
+	// the ttl of the BatchTTLGetter is kept
+	if _, ok := g.mainCache.get("k"); !ok {
+		t.Fatal("k should be cached")
+	}
+	now = now.Add(time.Second)
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatal("k should expire after its ttl")
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if strings.HasSuffix(key, "missing") {
+			return nil, fmt.Errorf("%s not exist", key)
+		}
+		return []byte(key), nil
+	}), WithHotCache(0, 0))
+	g.RegisterPeers(prefixPicker{&fakePeer{}})
+	ctx := context.Background()
+	for _, key := range []string{"l1", "l1", "r1", "lmissing"} {
+		g.GetContext(ctx, key)
+	}
+	g.getForPeer(ctx, "l2")
+
+	stats := g.Stats()
+	want := Stats{Gets: 5, Hits: 1, Misses: 4, Loads: 4, LoadsDeduped: 4, PeerLoads: 1, LocalLoads: 2, LocalLoadErrs: 1, ServerRequests: 1}
+	want.Main, want.Hot = stats.Main, stats.Hot
+	if stats != want {
+		t.Fatalf("expect %+v, got %+v", want, stats)
+	}
+	if stats.Main.Items != 2 || stats.Main.Bytes == 0 || stats.Hot.Items != 0 {
+		t.Fatalf("unexpected cache stats %+v %+v", stats.Main, stats.Hot)
+	}
+
+	var sb strings.Builder
+	if err := WritePrometheus(&sb, map[string]Stats{"stats": stats, `a"b`: {}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE beecache_gets_total counter\n",
+		`beecache_gets_total{group="stats"} 5` + "\n",
+		`beecache_gets_total{group="a\"b"} 0` + "\n",
+		"# TYPE beecache_cache_items gauge\n",
+		`beecache_cache_items{group="stats",cache="main"} 2` + "\n",
+		`beecache_cache_items{group="stats",cache="hot"} 0` + "\n",
+	} {
+		if !strings.Contains(sb.String(), line) {
+			t.Fatalf("expect %q in\n%s", line, sb.String())
+		}
+	}
+}
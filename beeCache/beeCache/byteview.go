@@ -1,7 +1,15 @@
 package beeCache
 
+import "time"
+
 type ByteView struct {
 	b []byte
+	e time.Time // the expiration of the cached value, zero means never
+}
+
+// Expire returns when the value expires in the cache it was read from, zero means never
+func (view ByteView) Expire() time.Time {
+	return view.e
 }
 
 // Len returns the length of the byte
@@ -2,32 +2,230 @@ package beeCache
 
 import (
 	"beeCache/lru"
+	"beeCache/policy"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// janitorBatch bounds the expired entries removed while holding the lock
+const janitorBatch = 128
+
+// accessBatch is the number of accesses read under the shared lock buffered before they're recorded in the policy
+const accessBatch = 64
+
+// cache is split into shards by the hash of the keys, each one has its own lock and an equal part of cacheBytes
 type cache struct {
-	mx         sync.Mutex
-	lru        *lru.Cache
 	cacheBytes int64
+	now        func() time.Time
+	newPolicy  policy.Factory // lru.NewPolicy if nil
+	shardCount int            // 1 if not set
+	// sampling makes the hits read only under a shared lock, one hit out of sampling is promoted in the policy.
+	// Every hit is promoted under the exclusive lock if it's not above 1.
+	sampling int
+	initOnce sync.Once
+	seed     maphash.Seed
+	shards   []*shard
+}
+
+type shard struct {
+	mx          sync.RWMutex
+	entries     policy.Policy
+	recorder    policy.AccessRecorder // entries if it learns from the accesses, see accessed
+	accessMu    sync.Mutex
+	accesses    []string // the accesses read under the shared lock, not recorded yet
+	reads       atomic.Uint64
+	gets        atomic.Int64
+	hits        atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+// CacheStats are the statistics of a cache
+type CacheStats struct {
+	Bytes       int64 `json:"bytes"`
+	Items       int64 `json:"items"`
+	Gets        int64 `json:"gets"`
+	Hits        int64 `json:"hits"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+}
+
+func (c *cache) init() {
+	c.initOnce.Do(func() {
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = lru.NewPolicy
+		}
+		n := max(c.shardCount, 1)
+		shardBytes := c.cacheBytes / int64(n)
+		if c.cacheBytes > 0 && shardBytes == 0 {
+			shardBytes = 1
+		}
+		c.seed = maphash.MakeSeed()
+		c.shards = make([]*shard, n)
+		for i := range c.shards {
+			s := &shard{}
+			s.entries = newPolicy(policy.Options{
+				MaxBytes:  shardBytes,
+				OnEvicted: func(string, policy.Value) { s.evictions.Add(1) },
+				OnExpired: func(string, policy.Value) { s.expirations.Add(1) },
+				Now:       c.now,
+			})
+			s.recorder, _ = s.entries.(policy.AccessRecorder)
+			c.shards[i] = s
+		}
+	})
 }
 
-func (c *cache) add(key string, value ByteView) {
-	c.mx.Lock()
-	defer c.mx.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+func (c *cache) shard(key string) *shard {
+	c.init()
+	if len(c.shards) == 1 {
+		return c.shards[0]
 	}
-	c.lru.Add(key, value)
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// add adds the value expiring at expire, zero means never
+func (c *cache) add(key string, value ByteView, expire time.Time) {
+	s := c.shard(key)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	value.e = expire
+	s.entries.AddWithExpire(key, value, expire)
+}
+
+// remove removes the key, it reports whether it was cached
+func (c *cache) remove(key string) bool {
+	s := c.shard(key)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.entries.Remove(key)
 }
 
 func (c *cache) get(key string) (byteView ByteView, ok bool) {
-	c.mx.Lock()
-	defer c.mx.Unlock()
-	if c.lru == nil {
-		return
+	s := c.shard(key)
+	s.gets.Add(1)
+	if c.sampling > 1 {
+		s.mx.RLock()
+		v, expire, ok := s.entries.Peek(key)
+		s.mx.RUnlock()
+		if !ok {
+			s.accessed(key)
+			return ByteView{}, false
+		}
+		fresh := expire.IsZero() || c.clock().Before(expire)
+		if fresh && s.reads.Add(1)%uint64(c.sampling) != 0 {
+			s.accessed(key)
+			s.hits.Add(1)
+			return v.(ByteView), true
+		}
 	}
-	if v, ok := c.lru.Get(key); ok {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if v, ok := s.entries.Get(key); ok {
+		s.hits.Add(1)
 		return v.(ByteView), ok
 	}
 	return
 }
+
+// accessed buffers an access which skipped Get, the batch is recorded in the policy once full:
+// the frequencies deciding the admission of W-TinyLFU must count all the accesses
+func (s *shard) accessed(key string) {
+	if s.recorder == nil {
+		return
+	}
+	s.accessMu.Lock()
+	s.accesses = append(s.accesses, key)
+	if len(s.accesses) < accessBatch {
+		s.accessMu.Unlock()
+		return
+	}
+	batch := s.accesses
+	s.accesses = make([]string, 0, accessBatch)
+	s.accessMu.Unlock()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, key := range batch {
+		s.recorder.RecordAccess(key)
+	}
+}
+
+// removeExpired removes the expired entries by batches, the lock is released between them
+func (c *cache) removeExpired() int {
+	c.init()
+	total := 0
+	for _, s := range c.shards {
+		for {
+			s.mx.Lock()
+			n := s.entries.RemoveExpired(janitorBatch)
+			s.mx.Unlock()
+			total += n
+			if n < janitorBatch {
+				break
+			}
+		}
+	}
+	return total
+}
+
+// janitor removes the expired entries every interval until stop is closed
+func (c *cache) janitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+type entry struct {
+	key    string
+	value  ByteView
+	expire time.Time
+}
+
+// entries copies the entries of the shards one at a time under their read lock, roughly the next evicted first
+func (c *cache) entries() []entry {
+	c.init()
+	var entries []entry
+	for _, s := range c.shards {
+		s.mx.RLock()
+		s.entries.Range(func(e *policy.Entry) bool {
+			entries = append(entries, entry{key: e.Key, value: e.Value.(ByteView), expire: e.Expire})
+			return true
+		})
+		s.mx.RUnlock()
+	}
+	return entries
+}
+
+func (c *cache) stats() CacheStats {
+	c.init()
+	var stats CacheStats
+	for _, s := range c.shards {
+		s.mx.RLock()
+		stats.Bytes += s.entries.Bytes()
+		stats.Items += int64(s.entries.Len())
+		s.mx.RUnlock()
+		stats.Gets += s.gets.Load()
+		stats.Hits += s.hits.Load()
+		stats.Evictions += s.evictions.Load()
+		stats.Expirations += s.expirations.Load()
+	}
+	return stats
+}
@@ -0,0 +1,130 @@
+package beeCache
+
+import (
+	"beeCache/tinylfu"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShards(t *testing.T) {
+	c := &cache{cacheBytes: 1600, shardCount: 16}
+	for i := 0; i < 1000; i++ {
+		c.add(fmt.Sprintf("key%03d", i), ByteView{b: []byte("0123456789")}, time.Time{})
+	}
+	stats := c.stats()
+	if stats.Bytes > 1600 || stats.Items+stats.Evictions != 1000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	for _, s := range c.shards {
+		if s.entries.Bytes() > 100 {
+			t.Fatalf("a shard holds %d bytes, more than its budget", s.entries.Bytes())
+		}
+	}
+}
+
+func TestReadSampling(t *testing.T) {
+	now := time.Now()
+	c := &cache{cacheBytes: 20, sampling: 4, now: func() time.Time { return now }}
+	c.add("k1", ByteView{b: []byte("v1")}, time.Time{})
+	c.add("k2", ByteView{b: []byte("v2")}, now.Add(time.Second))
+	for i := 0; i < 8; i++ {
+		if v, ok := c.get("k1"); !ok || v.String() != "v1" {
+			t.Fatal("k1 should be cached")
+		}
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.get("k2"); ok {
+		t.Fatal("k2 should be expired")
+	}
+	if _, ok := c.get("k3"); ok {
+		t.Fatal("k3 shouldn't be cached")
+	}
+	stats := c.stats()
+	if stats.Gets != 10 || stats.Hits != 8 || stats.Expirations != 1 || stats.Items != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReadSamplingHitRatio(t *testing.T) {
+	// the popular keys change halfway, the new ones must win their admission against the old ones
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, 9999)
+	trace := make([]string, 200000)
+	for i := range trace {
+		prefix := "old"
+		if i >= len(trace)/2 {
+			prefix = "new"
+		}
+		trace[i] = fmt.Sprintf("%s%d", prefix, z.Uint64())
+	}
+	hitRatio := func(sampling int) float64 {
+		// room for about 10% of the keys
+		c := &cache{cacheBytes: 1000 * 20, sampling: sampling, newPolicy: tinylfu.NewPolicy}
+		hits := 0
+		for i, key := range trace {
+			if _, ok := c.get(key); ok && i >= len(trace)/2 {
+				hits++
+			} else if !ok {
+				c.add(key, ByteView{b: []byte("0123456789")}, time.Time{})
+			}
+		}
+		return float64(hits) / float64(len(trace)/2)
+	}
+	// the accesses skipping the policy still count for the admission
+	exact, sampled := hitRatio(0), hitRatio(8)
+	t.Logf("hit ratio %.3f, %.3f with sampling", exact, sampled)
+	if sampled < exact*0.9 {
+		t.Fatalf("the sampling shouldn't starve the admission, hit ratio %.3f instead of %.3f", sampled, exact)
+	}
+}
+
+func TestConcurrentShards(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, shardCount: 4, sampling: 2}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("key%d", (i*j)%100)
+				if _, ok := c.get(key); !ok {
+					c.add(key, ByteView{b: []byte(key)}, time.Time{})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats := c.stats(); stats.Gets != 8000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// BenchmarkCacheGetParallel reads 1000 cached keys from all the cores,
+// eg. go test -bench GetParallel -run ^$ -cpu 1,4,8 beeCache
+func BenchmarkCacheGetParallel(b *testing.B) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, bc := range []struct {
+		shards, sampling int
+	}{{1, 0}, {16, 0}, {1, 8}, {16, 8}} {
+		b.Run(fmt.Sprintf("shards=%d/sampling=%d", bc.shards, bc.sampling), func(b *testing.B) {
+			c := &cache{shardCount: bc.shards, sampling: bc.sampling}
+			for _, key := range keys {
+				c.add(key, ByteView{b: []byte(key)}, time.Time{})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
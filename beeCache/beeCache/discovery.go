@@ -0,0 +1,134 @@
+package beeCache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Discovery tells the peers of the cluster, this one included
+type Discovery interface {
+	// Peers returns the current peers
+	Peers() ([]string, error)
+	// Watch calls update with the peers every time they change until stop is closed
+	Watch(update func(peers []string), stop <-chan struct{})
+}
+
+// StaticDiscovery is a fixed list of peers
+type StaticDiscovery []string
+
+func (d StaticDiscovery) Peers() ([]string, error) {
+	return slices.Clone(d), nil
+}
+
+// Watch returns at once, the peers never change
+func (d StaticDiscovery) Watch(update func(peers []string), stop <-chan struct{}) {}
+
+const defaultPollInterval = 10 * time.Second
+
+// FileDiscovery reads the peers from a file, one per line, blank lines and lines starting with # are skipped.
+// The file is polled, so it may be replaced by a config management tool or a mounted ConfigMap.
+type FileDiscovery struct {
+	Path     string
+	Interval time.Duration // how often the file is read, 10s by default
+}
+
+func NewFileDiscovery(path string, interval time.Duration) *FileDiscovery {
+	return &FileDiscovery{Path: path, Interval: interval}
+}
+
+func (d *FileDiscovery) Peers() ([]string, error) {
+	b, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			peers = append(peers, line)
+		}
+	}
+	return peers, scanner.Err()
+}
+
+func (d *FileDiscovery) Watch(update func(peers []string), stop <-chan struct{}) {
+	poll(d.Peers, d.Interval, update, stop)
+}
+
+// RegistryDiscovery gets the peers from a beeRPC BeeRegistry, each peer sends its heartbeats
+// with registry.HeartBeats and is forgotten once they stop
+type RegistryDiscovery struct {
+	Registry string        // url of the registry, eg. http://localhost:9999/_beerpc_/registry
+	Interval time.Duration // how often the registry is queried, 10s by default
+}
+
+func NewRegistryDiscovery(registry string, interval time.Duration) *RegistryDiscovery {
+	return &RegistryDiscovery{Registry: registry, Interval: interval}
+}
+
+// Peers returns the alive servers of the registry, they're listed in the X-Beerpc-Servers header
+func (d *RegistryDiscovery) Peers() ([]string, error) {
+	resp, err := http.Get(d.Registry)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned: %v", resp.Status)
+	}
+	var peers []string
+	for _, peer := range strings.Split(resp.Header.Get("X-Beerpc-Servers"), ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, nil
+}
+
+func (d *RegistryDiscovery) Watch(update func(peers []string), stop <-chan struct{}) {
+	poll(d.Peers, d.Interval, update, stop)
+}
+
+// poll calls peers every interval and update when they change, until stop is closed.
+// The errors and the empty lists keep the current peers.
+func poll(peers func() ([]string, error), interval time.Duration, update func(peers []string), stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last []string
+	polled := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		current, err := peers()
+		if err == nil && len(current) == 0 {
+			// 注册中心重启或心跳过期时列表为空，不应清空整个环
+			err = errors.New("no peers found")
+		}
+		if err != nil {
+			// keep the current peers, an unreachable source doesn't mean the cluster is gone
+			log.Println("[BeeCache] discovery error:", err)
+			continue
+		}
+		slices.Sort(current)
+		if !polled || !slices.Equal(current, last) {
+			polled = true
+			last = current
+			update(slices.Clone(current))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package beeCache
+
+import (
+	"fmt"
+	"github.com/blkcor/beeRPC/registry"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// watch collects the updates of the discovery
+func watch(t *testing.T, d Discovery) <-chan []string {
+	updates := make(chan []string, 16)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go d.Watch(func(peers []string) { updates <- peers }, stop)
+	return updates
+}
+
+func waitPeers(t *testing.T, updates <-chan []string, want []string) {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case peers := <-updates:
+			if reflect.DeepEqual(peers, want) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("never got the peers %v", want)
+		}
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	os.WriteFile(path, []byte("# the cluster\nhttp://b:8001\n\nhttp://a:8001\n"), 0o644)
+	d := NewFileDiscovery(path, time.Millisecond)
+	if peers, err := d.Peers(); err != nil || !reflect.DeepEqual(peers, []string{"http://b:8001", "http://a:8001"}) {
+		t.Fatalf("unexpected peers %v %v", peers, err)
+	}
+
+	updates := watch(t, d)
+	waitPeers(t, updates, []string{"http://a:8001", "http://b:8001"})
+	os.WriteFile(path, []byte("http://a:8001\nhttp://c:8001\n"), 0o644)
+	waitPeers(t, updates, []string{"http://a:8001", "http://c:8001"})
+}
+
+func TestRegistryDiscovery(t *testing.T) {
+	server := httptest.NewServer(registry.New(time.Minute))
+	defer server.Close()
+	heartbeat := func(addr string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+		req.Header.Set("X-Beerpc-Server", addr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	heartbeat("http://a:8001")
+
+	d := NewRegistryDiscovery(server.URL, time.Millisecond)
+	updates := watch(t, d)
+	waitPeers(t, updates, []string{"http://a:8001"})
+	heartbeat("http://b:8001")
+	waitPeers(t, updates, []string{"http://a:8001", "http://b:8001"})
+}
+
+func TestPollEmpty(t *testing.T) {
+	lists := make(chan []string, 4)
+	lists <- []string{"http://b:8001", "http://a:8001"}
+	lists <- []string{"http://a:8001", "http://b:8001"}
+	lists <- nil
+	lists <- []string{"http://a:8001"}
+	peers := func() ([]string, error) {
+		select {
+		case list := <-lists:
+			return list, nil
+		default:
+			return []string{"http://a:8001"}, nil
+		}
+	}
+	updates := make(chan []string, 16)
+	stop := make(chan struct{})
+	defer close(stop)
+	go poll(peers, time.Millisecond, func(peers []string) { updates <- peers }, stop)
+
+	// the same list isn't sent twice and the empty one is skipped
+	var got [][]string
+	deadline := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case peers := <-updates:
+			got = append(got, peers)
+		case <-deadline:
+			t.Fatalf("got only the updates %v", got)
+		}
+	}
+	want := [][]string{{"http://a:8001", "http://b:8001"}, {"http://a:8001"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expect the updates %v, got %v", want, got)
+	}
+}
+
+func TestHTTPPoolMembership(t *testing.T) {
+	pool := NewHTTPPool("http://a:8001")
+	d := StaticDiscovery{"http://a:8001", "http://b:8001", "http://c:8001"}
+	if err := pool.Watch(d, nil); err != nil {
+		t.Fatal(err)
+	}
+	owner := func(key string) string {
+		if peer, ok := pool.PickPeer(key); ok {
+			return peer.(*httpGetter).baseURL
+		}
+		return pool.self + pool.basePath
+	}
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = owner(key)
+	}
+	leaving, _ := pool.PickPeer("key0")
+
+	pool.Set("http://a:8001", "http://c:8001", "http://d:8001")
+	if len(pool.Peers()) != 2 {
+		t.Fatalf("expect c and d as peers, got %d", len(pool.Peers()))
+	}
+	for key, was := range before {
+		now := owner(key)
+		if was != "http://b:8001"+defaultBasePath && now != was && now != "http://d:8001"+defaultBasePath {
+			t.Fatalf("%s moved from %s to %s", key, was, now)
+		}
+	}
+	// a getter picked before b left still points to it
+	if leaving != nil && leaving.(*httpGetter).baseURL == "" {
+		t.Fatal("the picked getter should be kept intact")
+	}
+}
@@ -0,0 +1,83 @@
+package beeCache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFails     = 3
+	defaultEjectTime    = time.Second
+	defaultMaxEjectTime = time.Minute
+	// healthPath answers 200 to the active health checks
+	healthPath = "_health"
+)
+
+// peerHealth tracks the requests to a peer. After maxFails consecutive failures the peer is ejected: it isn't
+// picked for ejectTime, doubled up to maxEjectTime each time it fails again once let back. A success resets it.
+// A nil peerHealth is always healthy.
+type peerHealth struct {
+	maxFails     int
+	ejectTime    time.Duration
+	maxEjectTime time.Duration
+
+	mu        sync.Mutex
+	fails     int
+	ejections int       // consecutive ejections
+	until     time.Time // the peer is ejected until then
+}
+
+func (h *peerHealth) healthy(now time.Time) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !now.Before(h.until)
+}
+
+func (h *peerHealth) success() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fails, h.ejections, h.until = 0, 0, time.Time{}
+}
+
+// failure records a failed request, it reports whether the peer got ejected
+func (h *peerHealth) failure(now time.Time) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// 已经被剔除，正在进行中的请求失败不再延长退避时间
+	if now.Before(h.until) {
+		return false
+	}
+	h.fails++
+	if h.fails < h.maxFails {
+		return false
+	}
+	backoff := h.ejectTime << min(h.ejections, 30)
+	if backoff <= 0 || backoff > h.maxEjectTime {
+		backoff = h.maxEjectTime
+	}
+	h.ejections++
+	h.until = now.Add(backoff)
+	return true
+}
+
+// report records the result of a request to the peer, err is the reason it couldn't be served, nil if the peer
+// answered. A request given up by the caller doesn't count.
+func (h *peerHealth) report(ctx context.Context, err error) {
+	switch {
+	case err != nil && ctx.Err() != nil:
+	case err != nil:
+		h.failure(time.Now())
+	default:
+		h.success()
+	}
+}
@@ -0,0 +1,208 @@
+package beeCache
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/blkcor/beeCache/proto"
+	"github.com/golang/protobuf/proto"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// killablePeer answers the Gets with its name, it can be killed and revived on the same address
+type killablePeer struct {
+	t      *testing.T
+	name   string
+	addr   string
+	server *httptest.Server
+	sets   atomic.Int32
+}
+
+func newKillablePeer(t *testing.T, name string) *killablePeer {
+	p := &killablePeer{t: t, name: name}
+	p.start("127.0.0.1:0")
+	t.Cleanup(p.kill)
+	return p
+}
+
+func (p *killablePeer) start(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.addr = ln.Addr().String()
+	p.server = &httptest.Server{Listener: ln, Config: &http.Server{Handler: p}}
+	p.server.Start()
+}
+
+func (p *killablePeer) url() string {
+	return "http://" + p.addr
+}
+
+func (p *killablePeer) kill() {
+	if p.server != nil {
+		p.server.Close()
+		p.server = nil
+	}
+}
+
+func (p *killablePeer) revive() {
+	p.start(p.addr)
+}
+
+func (p *killablePeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, healthPath):
+	case r.Method == http.MethodGet:
+		body, _ := proto.Marshal(&pb.Response{Value: []byte(p.name)})
+		w.Write(body)
+	case r.Method == http.MethodPut:
+		p.sets.Add(1)
+	}
+}
+
+// keyOwnedBy returns a key whose first owners are the given peers
+func keyOwnedBy(t *testing.T, pool *HTTPPool, owners ...string) string {
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if strings.Join(pool.peers.GetN(key, len(owners)), " ") == strings.Join(owners, " ") {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %v", owners)
+	return ""
+}
+
+func TestPeerHealth(t *testing.T) {
+	h := &peerHealth{maxFails: 2, ejectTime: time.Second, maxEjectTime: 3 * time.Second}
+	now := time.Now()
+	if h.failure(now) || !h.healthy(now) {
+		t.Fatal("one failure shouldn't eject")
+	}
+	if !h.failure(now) || h.healthy(now) || !h.healthy(now.Add(time.Second)) {
+		t.Fatal("expect ejected for 1s")
+	}
+	// the requests in flight failing don't extend the ejection
+	if h.failure(now.Add(time.Millisecond)) || !h.healthy(now.Add(time.Second)) {
+		t.Fatal("the ejection shouldn't be extended")
+	}
+	now = now.Add(time.Second)
+	if !h.failure(now) || h.healthy(now.Add(2*time.Second-1)) || !h.healthy(now.Add(2*time.Second)) {
+		t.Fatal("expect ejected again for 2s")
+	}
+	now = now.Add(2 * time.Second)
+	if !h.failure(now) || h.healthy(now.Add(3*time.Second-1)) || !h.healthy(now.Add(3*time.Second)) {
+		t.Fatal("expect the ejection capped to 3s")
+	}
+	h.success()
+	if !h.healthy(now) || h.failure(now) {
+		t.Fatal("a success should reset the peer")
+	}
+	var none *peerHealth
+	if none.failure(now) || !none.healthy(now) {
+		t.Fatal("a nil peerHealth should be healthy")
+	}
+}
+
+func TestHTTPPoolFailover(t *testing.T) {
+	a, b := newKillablePeer(t, "a"), newKillablePeer(t, "b")
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{MaxFails: 1, EjectTime: time.Minute})
+	pool.Set("http://self", a.url(), b.url())
+	g := NewGroup("failover", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}), WithHotCache(0, 0))
+	g.RegisterPeers(pool)
+
+	mine := keyOwnedBy(t, pool, a.url(), "http://self")
+	if v, err := g.GetContext(context.Background(), mine); err != nil || v.String() != "a" {
+		t.Fatalf("expect the value of a, got %v %v", v, err)
+	}
+	a.kill()
+	// the request to a fails and the key is loaded locally, a is ejected
+	key := keyOwnedBy(t, pool, a.url(), b.url())
+	if v, err := g.GetContext(context.Background(), key); err != nil || v.String() != "local" {
+		t.Fatalf("expect the value loaded locally, got %v %v", v, err)
+	}
+	// the keys of a now go to the next owner on the ring without trying a
+	if peer, ok := pool.PickPeer(key); !ok || peer.(*httpGetter).baseURL != b.url()+defaultBasePath {
+		t.Fatalf("expect b picked, got %v", peer)
+	}
+	if err := g.Remove(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.GetContext(context.Background(), key); err != nil || v.String() != "b" {
+		t.Fatalf("expect the value of b, got %v %v", v, err)
+	}
+	if _, ok := pool.PickPeer(mine); ok {
+		t.Fatal("expect the key owned by this peer")
+	}
+	if len(pool.Peers()) != 1 {
+		t.Fatal("the ejected peer shouldn't be listed")
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	a := newKillablePeer(t, "a")
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{MaxFails: 1, EjectTime: time.Minute})
+	pool.Set("http://self", a.url())
+	stop := make(chan struct{})
+	defer close(stop)
+	pool.CheckHealth(5*time.Millisecond, stop)
+	waitPeerCount := func(n int) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for len(pool.Peers()) != n {
+			select {
+			case <-deadline:
+				t.Fatalf("expect %d peers, got %d", n, len(pool.Peers()))
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	a.kill()
+	waitPeerCount(0)
+	// a is let back as soon as it answers, long before the end of its ejection
+	a.revive()
+	waitPeerCount(1)
+}
+
+func TestReplicas(t *testing.T) {
+	a, b, c := newKillablePeer(t, "a"), newKillablePeer(t, "b"), newKillablePeer(t, "c")
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Replicas: 2, MaxFails: 1, EjectTime: time.Minute})
+	pool.Set("http://self", a.url(), b.url(), c.url())
+	g := NewGroup("replicas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}), WithHotCache(0, 0))
+	g.RegisterPeers(pool)
+
+	key := keyOwnedBy(t, pool, a.url(), b.url())
+	if err := g.Set(context.Background(), key, []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if a.sets.Load() != 1 || b.sets.Load() != 1 || c.sets.Load() != 0 {
+		t.Fatalf("expect the value set on a and b, got %d %d %d", a.sets.Load(), b.sets.Load(), c.sets.Load())
+	}
+	// the first replica is down, the read is served by the second one
+	a.kill()
+	if v, err := g.GetContext(context.Background(), key); err != nil || v.String() != "b" {
+		t.Fatalf("expect the value of the second replica, got %v %v", v, err)
+	}
+	if stats := g.Stats(); stats.PeerErrors != 1 || stats.PeerLoads != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// this peer is a replica, it stores the value and serves it
+	key = keyOwnedBy(t, pool, "http://self", c.url())
+	if err := g.Set(context.Background(), key, []byte("mine"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.GetContext(context.Background(), key); err != nil || v.String() != "mine" || c.sets.Load() != 1 {
+		t.Fatalf("unexpected value %v %v with %d sets on c", v, err, c.sets.Load())
+	}
+}
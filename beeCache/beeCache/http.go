@@ -1,6 +1,10 @@
 package beeCache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/blkcor/beeCache/consistentHash"
 	pb "github.com/blkcor/beeCache/proto"
@@ -8,35 +12,81 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_beeCache/"
 	defaultReplicas = 50
+	defaultTimeout  = 10 * time.Second
+	// timeoutHeader carries the time left to the caller in milliseconds, the peer gives up after it
+	timeoutHeader = "X-Beecache-Timeout"
+	// statsPath and metricsPath serve the statistics of the groups in JSON and in the Prometheus format, like
+	// healthPath they can't be taken for a group as they have no key
+	statsPath   = "_stats"
+	metricsPath = "_metrics"
 )
 
+// HTTPPool serves the peers under basePath and picks the peer owning a key. The peers aren't
+// authenticated and PUT/DELETE write to the groups, so the pool must only be reachable by the peers.
 type HTTPPool struct {
-	//记录http的主机 / ip + 端口
-	self        string
-	basePath    string
-	mu          sync.Mutex
-	peers       *consistentHash.Map
-	httpGetters map[string]*httpGetter
+	*peerRing
+	basePath string
+	timeout  time.Duration
 }
 
 // NewHTTPPool creates a new HTTPPool instance
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
-	}
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// HTTPPoolOptions are the options of an HTTPPool, all the peers must use the same
+type HTTPPoolOptions struct {
+	// BasePath is the path prefix of the requests, /_beeCache/ by default
+	BasePath string
+	// Strategy maps the keys to the peers, a ring of 50 virtual nodes per peer by default
+	Strategy consistentHash.Strategy
+	// Timeout bounds the requests to the peers whose context has no deadline, 10s by default
+	Timeout time.Duration
+	// Replicas is the number of peers holding each key: its owner and the next distinct ones on the ring.
+	// The writes go to all of them and the reads to the first one, 1 by default.
+	Replicas int
+	// MaxFails is the number of consecutive failed requests ejecting a peer, 3 by default
+	MaxFails int
+	// EjectTime is how long a failing peer is skipped, doubled up to MaxEjectTime each time it fails again
+	// once let back. 1s and 1m by default.
+	EjectTime    time.Duration
+	MaxEjectTime time.Duration
 }
 
-// Log info with server name
-func (p *HTTPPool) Log(format string, v ...interface{}) {
-	fmt.Printf("[Server %s] %s\n", p.self, fmt.Sprintf(format, v...))
+// NewHTTPPoolOpts creates a new HTTPPool instance with the options, nil means the defaults
+func NewHTTPPoolOpts(self string, opts *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
+		basePath: defaultBasePath,
+		timeout:  defaultTimeout,
+	}
+	var ro ringOptions
+	if opts != nil {
+		if opts.BasePath != "" {
+			p.basePath = opts.BasePath
+		}
+		if opts.Timeout > 0 {
+			p.timeout = opts.Timeout
+		}
+		ro = ringOptions{
+			strategy:     opts.Strategy,
+			replicas:     opts.Replicas,
+			maxFails:     opts.MaxFails,
+			ejectTime:    opts.EjectTime,
+			maxEjectTime: opts.MaxEjectTime,
+		}
+	}
+	p.peerRing = newPeerRing(self, ro, func(peer string, health *peerHealth) peerClient {
+		return &httpGetter{baseURL: peer + p.basePath, timeout: p.timeout, health: health}
+	})
+	return p
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -46,6 +96,19 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	p.Log("%s %s", req.Method, req.URL.Path)
 
+	switch req.URL.Path[len(p.basePath):] {
+	case statsPath:
+		p.serveStats(w, req)
+		return
+	case metricsPath:
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w, AllStats())
+		return
+	case healthPath:
+		w.Write([]byte("ok"))
+		return
+	}
+
 	parts := strings.SplitN(req.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
@@ -59,12 +122,76 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "No such cache group "+groupName, http.StatusNotFound)
 		return
 	}
-	v, err := group.Get(key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	ctx := req.Context()
+	if ms, err := strconv.ParseInt(req.Header.Get(timeoutHeader), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+	var res pb.Response
+	switch req.Method {
+	case http.MethodGet:
+		// 不再转发给其他节点，节点变化期间两个节点可能都认为对方拥有这个key
+		v, err := group.getForPeer(ctx, key)
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Value = v.ByteSlice()
+		res.TtlMillis = group.ttlLeftMillis(v)
+	case http.MethodPost:
+		// 批量获取：请求体是序列化后的 BatchRequest，路径中没有key
+		if key != "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in := &pb.BatchRequest{}
+		if err := proto.Unmarshal(b, in); err != nil {
+			http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := proto.Marshal(group.batchResponse(group.getManyForPeer(ctx, in.Keys)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+		return
+	case http.MethodPut:
+		// 请求体是序列化后的 SetRequest
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in := &pb.SetRequest{}
+		if err := proto.Unmarshal(b, in); err != nil {
+			http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, in.Value, time.Duration(in.TtlMillis)*time.Millisecond)
+	case http.MethodDelete:
+		if req.URL.Query().Get("cache") == "hot" {
+			group.invalidate(key)
+		} else {
+			group.removeLocally(key)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	body, err := proto.Marshal(&pb.Response{Value: v.ByteSlice()})
+	body, err := proto.Marshal(&res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -77,38 +204,100 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (p *HTTPPool) Set(peers ...string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = consistentHash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+var (
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ PeerLister    = (*HTTPPool)(nil)
+)
+
+type httpGetter struct {
+	baseURL string
+	timeout time.Duration // bounds the requests whose context has no deadline
+	health  *peerHealth
+}
+
+// Get gets the key with context.Background(), bounded by the timeout of the pool
+func (g *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.do(ctx, http.MethodGet, g.url(in.Group, in.Key), nil, out)
+}
+
+// GetMany posts the keys to the path of the group
+func (g *httpGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
 	}
+	return g.do(ctx, http.MethodPost, g.url(in.Group, ""), body, out)
 }
 
-// PickPeer picks a peer according to key
-func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+func (g *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
 	}
-	return nil, false
+	return g.do(ctx, http.MethodPut, g.url(in.Group, in.Key), body, out)
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+func (g *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.do(ctx, http.MethodDelete, g.url(in.Group, in.Key), nil, out)
+}
 
-type httpGetter struct {
-	baseURL string
+func (g *httpGetter) Invalidate(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.do(ctx, http.MethodDelete, g.url(in.Group, in.Key)+"?cache=hot", nil, out)
 }
 
-func (g *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+// close does nothing, the idle connections of http.DefaultClient are closed by its transport
+func (g *httpGetter) close() {}
+
+// ping asks the health path of the peer
+func (g *httpGetter) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", resp.Status)
+	}
+	return nil
+}
+
+func (g *httpGetter) url(group, key string) string {
 	//对group和key进行编码
-	u := fmt.Sprintf("%v%v/%v", g.baseURL, url.QueryEscape(in.Group), url.QueryEscape(in.Key))
-	resp, err := http.Get(u)
+	return fmt.Sprintf("%v%v/%v", g.baseURL, url.PathEscape(group), url.PathEscape(key))
+}
+
+func (g *httpGetter) do(ctx context.Context, method, u string, body []byte, out proto.Message) error {
+	caller := ctx
+	if _, ok := ctx.Deadline(); !ok && g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	unavailable := err
+	if err == nil && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable) {
+		unavailable = errors.New(resp.Status)
+	}
+	g.health.report(caller, unavailable)
 	if err != nil {
 		return err
 	}
@@ -128,4 +317,19 @@ func (g *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 }
 
 // 进行编译时的接口实现检查。这行代码本身不会在运行时执行任何操作，它的目的是在编译时确保 httpGetter 类型实现了 PeerGetter 接口
-var _ PeerGetter = (*httpGetter)(nil)
+var _ peerClient = (*httpGetter)(nil)
+
+// serveStats writes the statistics of all the groups, or of the one given by the group parameter
+func (p *HTTPPool) serveStats(w http.ResponseWriter, req *http.Request) {
+	stats := AllStats()
+	if name := req.URL.Query().Get("group"); name != "" {
+		s, ok := stats[name]
+		if !ok {
+			http.Error(w, "No such cache group "+name, http.StatusNotFound)
+			return
+		}
+		stats = map[string]Stats{name: s}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
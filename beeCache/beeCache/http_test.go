@@ -1,8 +1,19 @@
 package beeCache
 
 import (
+	"context"
+	"encoding/json"
+	"github.com/blkcor/beeCache/consistentHash"
+	pb "github.com/blkcor/beeCache/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSplitN(t *testing.T) {
@@ -10,3 +21,209 @@ func TestSplitN(t *testing.T) {
 	s := strings.SplitN(str, "/", 2)
 	t.Log(s)
 }
+
+func TestHTTPSetRemove(t *testing.T) {
+	g := NewGroup("http-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("source"), nil
+	}))
+	pool := NewHTTPPool("")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	pool.self = server.URL
+	pool.Set(server.URL)
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+
+	if err := getter.Set(context.Background(), &pb.SetRequest{Group: g.name, Key: "a b", Value: []byte("v1")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	out := &pb.Response{}
+	if err := getter.GetContext(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, out); err != nil || string(out.Value) != "v1" {
+		t.Fatalf("expect v1, got %q %v", out.Value, err)
+	}
+	// the pool owns all the keys, an invalidation keeps them
+	if err := getter.Invalidate(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("a b"); !ok || v.String() != "v1" {
+		t.Fatal("the owner should keep the key")
+	}
+	if err := getter.Remove(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("a b"); ok {
+		t.Fatal("the key should be removed")
+	}
+	if len(pool.Peers()) != 0 {
+		t.Fatal("the pool shouldn't list itself")
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+defaultBasePath+g.name+"/k", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, got %d", resp.StatusCode)
+	}
+}
+
+// servePeer serves the pool of a peer, a process has a single group of a name so the peer renames
+// the group of the requests from "from" to its own
+func servePeer(t *testing.T, pool **HTTPPool, from, to string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.URL.Path = strings.Replace(req.URL.Path, "/"+from+"/", "/"+to+"/", 1)
+		(*pool).ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDisagreeingRings(t *testing.T) {
+	// each getter waits for the other, so both loads are in flight at once
+	var arrived atomic.Int32
+	both := make(chan struct{})
+	getter := func(name string) Getter {
+		return GetterWithContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+			if arrived.Add(1) == 2 {
+				close(both)
+			}
+			select {
+			case <-both:
+				return []byte(name), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+	}
+	a := NewGroup("ring-a", 2<<10, getter("a"), WithHotCache(0, 0))
+	b := NewGroup("ring-b", 2<<10, getter("b"), WithHotCache(0, 0))
+	var poolA, poolB *HTTPPool
+	serverA := servePeer(t, &poolA, b.name, a.name)
+	serverB := servePeer(t, &poolB, a.name, b.name)
+	// each peer thinks the other one owns all the keys
+	poolA = NewHTTPPoolOpts(serverA.URL, &HTTPPoolOptions{Timeout: 5 * time.Second})
+	poolA.Set(serverB.URL)
+	poolB = NewHTTPPoolOpts(serverB.URL, &HTTPPoolOptions{Timeout: 5 * time.Second})
+	poolB.Set(serverA.URL)
+	a.RegisterPeers(poolA)
+	b.RegisterPeers(poolB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	values := make(chan string, 2)
+	for _, g := range []*Group{a, b} {
+		go func(g *Group) {
+			v, err := g.GetContext(ctx, "key")
+			if err != nil {
+				values <- err.Error()
+				return
+			}
+			values <- g.name + "=" + v.String()
+		}(g)
+	}
+	got := []string{<-values, <-values}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"ring-a=b", "ring-b=a"}) {
+		t.Fatalf("expect each value loaded by the other peer, got %v", got)
+	}
+}
+
+func TestHTTPPoolStrategy(t *testing.T) {
+	strategy := consistentHash.NewMaglev(0, nil)
+	pool := NewHTTPPoolOpts("http://a:8001", &HTTPPoolOptions{BasePath: "/cache/", Strategy: strategy})
+	pool.Set("http://a:8001", "http://b:8001")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		peer, ok := pool.PickPeer(key)
+		if owner := strategy.Get(key); ok != (owner == "http://b:8001") || ok && peer.(*httpGetter).baseURL != owner+"/cache/" {
+			t.Fatalf("%s should be owned by %s", key, owner)
+		}
+	}
+}
+
+func TestHTTPDeadline(t *testing.T) {
+	deadlines := make(chan bool, 1)
+	NewGroup("http-slow", 2<<10, GetterWithContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{Timeout: time.Minute})
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, timeout: pool.timeout}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "http-slow", Key: "key"}, &pb.Response{}); err == nil {
+		t.Fatal("expect the deadline exceeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the request should give up after the deadline, took %v", elapsed)
+	}
+	if !<-deadlines {
+		t.Fatal("the deadline should be sent to the peer")
+	}
+}
+
+func TestHTTPGetMany(t *testing.T) {
+	db := &batchDB{}
+	g := NewGroup("http-many", 2<<10, db)
+	g.mainCache.add("cached", ByteView{b: []byte("hit")}, time.Time{})
+	server := httptest.NewServer(NewHTTPPool(""))
+	defer server.Close()
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+
+	out := &pb.BatchResponse{}
+	err := getter.GetMany(context.Background(), &pb.BatchRequest{Group: g.name, Keys: []string{"a", "cached", "missing"}}, out)
+	if err != nil || len(out.Results) != 3 {
+		t.Fatalf("unexpected response %v %v", out, err)
+	}
+	if string(out.Results[0].Value) != "local a" || string(out.Results[1].Value) != "hit" || out.Results[2].Error != "missing not exist" {
+		t.Fatalf("unexpected results %v", out.Results)
+	}
+	if !reflect.DeepEqual(db.batches, [][]string{{"a", "missing"}}) {
+		t.Fatalf("expect the misses loaded in one batch, got %v", db.batches)
+	}
+}
+
+func TestHTTPStats(t *testing.T) {
+	g := NewGroup("http-stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.GetContext(context.Background(), "a")
+	server := httptest.NewServer(NewHTTPPool(""))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + defaultBasePath + "_stats?group=" + g.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats map[string]Stats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil || stats[g.name].Gets != 1 || stats[g.name].Main.Items != 1 || len(stats) != 1 {
+		t.Fatalf("unexpected stats %+v %v", stats, err)
+	}
+	resp, err = http.Get(server.URL + defaultBasePath + "_stats?group=unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + defaultBasePath + "_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") ||
+		!strings.Contains(string(body), `beecache_local_loads_total{group="http-stats"} 1`) {
+		t.Fatalf("unexpected metrics %s\n%s", resp.Header.Get("Content-Type"), body)
+	}
+}
@@ -0,0 +1,209 @@
+// Package lfu implements a least frequently used cache, the least recently used entry is evicted among equals.
+package lfu
+
+import (
+	"beeCache/policy"
+	"container/list"
+	"time"
+)
+
+type Value = policy.Value
+
+// Cache is a LFU cache with O(1) operations, it keeps a list of frequencies in increasing order
+// and for each one the list of its entries, the most recently used at front
+type Cache struct {
+	maxBytes int64
+	nBytes   int64
+	freqs    *list.List // of *frequency
+	cache    map[string]*list.Element
+	expiries policy.Expiries
+	// OnEvicted is called when an entry is evicted to make room
+	OnEvicted func(key string, value Value)
+	// OnExpired is called when an expired entry is removed
+	OnExpired func(key string, value Value)
+	// Now is the clock deciding the expiration, time.Now by default
+	Now func() time.Time
+}
+
+type frequency struct {
+	count   uint64
+	entries *list.List // of *item
+}
+
+type item struct {
+	*policy.Entry
+	freq *list.Element // of *frequency
+}
+
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		freqs:     list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+		Now:       time.Now,
+	}
+}
+
+// NewPolicy creates a Cache as a policy.Policy
+func NewPolicy(opts policy.Options) policy.Policy {
+	c := New(opts.MaxBytes, opts.OnEvicted)
+	c.OnExpired = opts.OnExpired
+	if opts.Now != nil {
+		c.Now = opts.Now
+	}
+	return c
+}
+
+// Get returns the value and counts the access, an expired entry is removed
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	it := ele.Value.(*item)
+	if it.Expired(c.Now()) {
+		c.removeElement(ele)
+		if c.OnExpired != nil {
+			c.OnExpired(it.Key, it.Value)
+		}
+		return nil, false
+	}
+	c.touch(ele)
+	return it.Value, true
+}
+
+// touch moves the entry to the next frequency
+func (c *Cache) touch(ele *list.Element) {
+	it := ele.Value.(*item)
+	cur := it.freq
+	next := cur.Next()
+	count := cur.Value.(*frequency).count + 1
+	if next == nil || next.Value.(*frequency).count != count {
+		next = c.freqs.InsertAfter(&frequency{count: count, entries: list.New()}, cur)
+	}
+	c.moveTo(ele, next)
+}
+
+// moveTo moves the entry to the front of the entries of freq, the map is updated
+func (c *Cache) moveTo(ele *list.Element, freq *list.Element) {
+	it := ele.Value.(*item)
+	c.detach(ele)
+	it.freq = freq
+	c.cache[it.Key] = freq.Value.(*frequency).entries.PushFront(it)
+}
+
+// detach removes the entry from its frequency, an empty frequency is dropped
+func (c *Cache) detach(ele *list.Element) {
+	it := ele.Value.(*item)
+	entries := it.freq.Value.(*frequency).entries
+	entries.Remove(ele)
+	if entries.Len() == 0 {
+		c.freqs.Remove(it.freq)
+	}
+}
+
+// Peek returns the entry without recording the access, an expired entry is returned as is
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*item)
+		return e.Value, e.Expire, true
+	}
+	return
+}
+
+// Add adds an entry which never expires
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds an entry expiring at expire, updating an entry counts as an access
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		it := ele.Value.(*item)
+		c.nBytes += int64(value.Len()) - int64(it.Value.Len())
+		it.Value = value
+		c.expiries.Set(it.Entry, expire)
+		c.touch(ele)
+	} else {
+		it := &item{Entry: policy.NewEntry(key, value)}
+		first := c.freqs.Front()
+		if first == nil || first.Value.(*frequency).count != 1 {
+			first = c.freqs.PushFront(&frequency{count: 1, entries: list.New()})
+		}
+		it.freq = first
+		c.cache[key] = first.Value.(*frequency).entries.PushFront(it)
+		c.nBytes += it.Size()
+		c.expiries.Set(it.Entry, expire)
+	}
+	for c.maxBytes != 0 && c.nBytes > c.maxBytes {
+		c.RemoveLeastFrequent()
+	}
+}
+
+// RemoveLeastFrequent evicts the least recently used entry of the lowest frequency
+func (c *Cache) RemoveLeastFrequent() {
+	first := c.freqs.Front()
+	if first == nil {
+		return
+	}
+	ele := first.Value.(*frequency).entries.Back()
+	it := ele.Value.(*item)
+	c.removeElement(ele)
+	if c.OnEvicted != nil {
+		c.OnEvicted(it.Key, it.Value)
+	}
+}
+
+// Range calls fn for the entries from the least frequently used until it returns false
+func (c *Cache) Range(fn func(e *policy.Entry) bool) {
+	for f := c.freqs.Front(); f != nil; f = f.Next() {
+		for ele := f.Value.(*frequency).entries.Back(); ele != nil; ele = ele.Prev() {
+			if !fn(ele.Value.(*item).Entry) {
+				return
+			}
+		}
+	}
+}
+
+// Remove removes the key, no callback is called
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes at most limit expired entries, it returns how many were removed
+func (c *Cache) RemoveExpired(limit int) int {
+	n := 0
+	for ; n < limit; n++ {
+		e, ok := c.expiries.Expired(c.Now())
+		if !ok {
+			break
+		}
+		c.removeElement(c.cache[e.Key])
+		if c.OnExpired != nil {
+			c.OnExpired(e.Key, e.Value)
+		}
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	it := ele.Value.(*item)
+	c.detach(ele)
+	delete(c.cache, it.Key)
+	c.expiries.Remove(it.Entry)
+	c.nBytes -= it.Size()
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the size of the keys and values
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
@@ -1,24 +1,26 @@
 package lru
 
-import "container/list"
+import (
+	"beeCache/policy"
+	"container/list"
+	"time"
+)
 
 type Cache struct {
 	maxBytes int64
 	nBytes   int64
 	ll       *list.List
 	cache    map[string]*list.Element
+	expiries policy.Expiries
 	//某条记录被移除时的回调函数
 	OnEvicted func(key string, value Value)
+	//某条记录过期被删除时的回调函数
+	OnExpired func(key string, value Value)
+	// Now is the clock deciding the expiration, time.Now by default
+	Now func() time.Time
 }
 
-type entry struct {
-	key   string
-	value Value
-}
-
-type Value interface {
-	Len() int
-}
+type Value = policy.Value
 
 func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
 	return &Cache{
@@ -27,16 +29,43 @@ func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
 		ll:        list.New(),
 		cache:     make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		Now:       time.Now,
+	}
+}
+
+// NewPolicy creates a Cache as a policy.Policy
+func NewPolicy(opts policy.Options) policy.Policy {
+	c := New(opts.MaxBytes, opts.OnEvicted)
+	c.OnExpired = opts.OnExpired
+	if opts.Now != nil {
+		c.Now = opts.Now
 	}
+	return c
 }
 
-// Get the value of the element from the cache and update position
+// Get the value of the element from the cache and update position, an expired element is removed
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if v, ok := c.cache[key]; ok {
+		kv := v.Value.(*policy.Entry)
+		if kv.Expired(c.Now()) {
+			c.removeElement(v)
+			if c.OnExpired != nil {
+				c.OnExpired(kv.Key, kv.Value)
+			}
+			return nil, false
+		}
 		//将访问的元素移动到队尾(这里默认队首为back,队尾为front)
 		c.ll.MoveToFront(v)
-		kv := v.Value.(*entry)
-		return kv.value, true
+		return kv.Value, true
+	}
+	return
+}
+
+// Peek returns the entry without recording the access, an expired entry is returned as is
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*policy.Entry)
+		return e.Value, e.Expire, true
 	}
 	return
 }
@@ -44,35 +73,70 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 // RemoveOldest remove  the record from the queue and the cache
 func (c *Cache) RemoveOldest() {
 	if ele := c.ll.Back(); ele != nil {
-		//先从队列中删除
-		c.ll.Remove(ele)
-		//再删除缓存中的key，并且更新缓存信息
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+		c.removeElement(ele)
 		//判断删除元素的回调是否注册
+		kv := ele.Value.(*policy.Entry)
 		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+			c.OnEvicted(kv.Key, kv.Value)
 		}
 	}
 }
 
-// Add new record to the cache
+// Remove removes the key, no callback is called
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes at most limit expired records, it returns how many were removed
+func (c *Cache) RemoveExpired(limit int) int {
+	n := 0
+	for ; n < limit; n++ {
+		kv, ok := c.expiries.Expired(c.Now())
+		if !ok {
+			break
+		}
+		c.removeElement(c.cache[kv.Key])
+		if c.OnExpired != nil {
+			c.OnExpired(kv.Key, kv.Value)
+		}
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	//先从队列中删除
+	c.ll.Remove(ele)
+	//再删除缓存中的key，并且更新缓存信息
+	kv := ele.Value.(*policy.Entry)
+	delete(c.cache, kv.Key)
+	c.expiries.Remove(kv)
+	c.nBytes -= kv.Size()
+}
+
+// Add new record to the cache, it never expires
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a record expiring at expire, zero means never
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	//如果key存在在cache中，但是值有变化
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
-		c.nBytes += int64(value.Len()) - int64(kv.value.Len())
-		kv.value = value
+		kv := ele.Value.(*policy.Entry)
+		c.nBytes += int64(value.Len()) - int64(kv.Value.Len())
+		kv.Value = value
+		c.expiries.Set(kv, expire)
 	} else {
 		//key不存在在cache中，直接插入
-		ele := c.ll.PushFront(&entry{
-			key:   key,
-			value: value,
-		})
-		c.cache[key] = ele
-		c.nBytes += int64(len(key)) + int64(value.Len())
+		kv := policy.NewEntry(key, value)
+		c.cache[key] = c.ll.PushFront(kv)
+		c.nBytes += kv.Size()
+		c.expiries.Set(kv, expire)
 	}
 	//是否达到cache的最大值 ==> 淘汰元素
 	//maxBytes为0的时候容量没有限制
@@ -81,7 +145,21 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// Range calls fn for the entries from the least recently used until it returns false
+func (c *Cache) Range(fn func(e *policy.Entry) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		if !fn(ele.Value.(*policy.Entry)) {
+			return
+		}
+	}
+}
+
 // Len return the length of the list
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes returns the size of the keys and values
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
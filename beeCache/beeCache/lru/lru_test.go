@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -57,3 +58,35 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	expired := make([]string, 0)
+	lru := New(int64(0), nil)
+	lru.Now = func() time.Time { return now }
+	lru.OnExpired = func(key string, value Value) {
+		expired = append(expired, key)
+	}
+	lru.AddWithExpire("k1", String("v1"), now.Add(time.Second))
+	lru.AddWithExpire("k2", String("v2"), now.Add(3*time.Second))
+	lru.AddWithExpire("k3", String("v3"), now.Add(2*time.Second))
+	lru.Add("k4", String("v4"))
+	// k2 doesn't expire anymore
+	lru.Add("k2", String("v2"))
+
+	now = now.Add(time.Second)
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("k1 should be expired")
+	}
+	if _, ok := lru.Get("k3"); !ok {
+		t.Fatalf("k3 shouldn't be expired")
+	}
+
+	now = now.Add(time.Hour)
+	if n := lru.RemoveExpired(10); n != 1 || lru.Len() != 2 || lru.Bytes() != 8 {
+		t.Fatalf("expect k3 removed, got %d removed and %d left", n, lru.Len())
+	}
+	if !reflect.DeepEqual(expired, []string{"k1", "k3"}) {
+		t.Fatalf("unexpected expired keys %v", expired)
+	}
+}
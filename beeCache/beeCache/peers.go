@@ -1,11 +1,54 @@
 package beeCache
 
-import pb "github.com/blkcor/beeCache/proto"
+import (
+	"context"
+	pb "github.com/blkcor/beeCache/proto"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (PeerGetter, bool)
 }
 
+// PeerLister is a PeerPicker listing its peers, Set and Remove invalidate the key on all of them.
+// Without it only the owners of the key are updated, the hot caches of the others keep it until it expires.
+type PeerLister interface {
+	PeerPicker
+	// Peers returns all the peers but this one
+	Peers() []PeerGetter
+}
+
+// ReplicaPicker is a PeerPicker keeping each key on several peers, the writes go to all of them
+type ReplicaPicker interface {
+	PeerPicker
+	// PickReplicas returns the other peers holding the key and whether this one holds it too
+	PickReplicas(key string) (peers []PeerGetter, self bool)
+}
+
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// PeerGetterWithContext is a PeerGetter giving up once ctx is done. The PeerGetters without context keep working,
+// a Group calls GetContext rather than Get if the peer has it.
+type PeerGetterWithContext interface {
+	PeerGetter
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// BatchPeerGetter gets several keys owned by the peer in one request, GetMany asks the keys one by one
+// to the peers without it
+type BatchPeerGetter interface {
+	PeerGetter
+	GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+}
+
+// PeerWriter changes the keys of a peer, Set, Remove and the invalidations fail on the peers without it
+type PeerWriter interface {
+	PeerGetter
+	// Set stores the value on the owner of the key
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error
+	// Remove removes the key from the owner
+	Remove(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Invalidate drops the key from the hot cache of the peer
+	Invalidate(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
@@ -0,0 +1,139 @@
+// Package policy defines the eviction policies of the beeCache caches and the helpers they share.
+package policy
+
+import (
+	"container/heap"
+	"time"
+)
+
+type Value interface {
+	Len() int
+}
+
+// Policy stores the entries of a cache and decides which ones are evicted once it holds more than MaxBytes.
+// OnEvicted is called for the entries evicted to make room, OnExpired for the expired ones, Remove calls neither.
+// It isn't safe for concurrent use.
+type Policy interface {
+	Get(key string) (value Value, ok bool)
+	// Peek returns the entry without recording the access nor removing it if it has expired.
+	// It only reads the policy, so concurrent Peeks are safe as long as nothing else runs.
+	Peek(key string) (value Value, expire time.Time, ok bool)
+	Add(key string, value Value)
+	// AddWithExpire adds an entry expiring at expire, zero means never
+	AddWithExpire(key string, value Value, expire time.Time)
+	Remove(key string) bool
+	// RemoveExpired removes at most limit expired entries, it returns how many were removed
+	RemoveExpired(limit int) int
+	Len() int
+	// Bytes returns the size of the keys and values
+	Bytes() int64
+	// Range calls fn for the entries, roughly the next evicted first, until it returns false.
+	// Like Peek it only reads the policy and includes the expired entries.
+	Range(fn func(e *Entry) bool)
+}
+
+// AccessRecorder is a Policy whose admission learns from the accesses, eg. W-TinyLFU. RecordAccess records
+// an access of the key, cached or not, without promoting it: the caches reading under a shared lock call it
+// for the accesses which skipped Get. Like Get it isn't safe for concurrent use.
+type AccessRecorder interface {
+	RecordAccess(key string)
+}
+
+// Options configures a Policy
+type Options struct {
+	// MaxBytes bounds the size of the keys and values, 0 means no limit
+	MaxBytes  int64
+	OnEvicted func(key string, value Value)
+	OnExpired func(key string, value Value)
+	// Now is the clock deciding the expiration, time.Now by default
+	Now func() time.Time
+}
+
+// Factory creates a Policy, eg. lru.NewPolicy
+type Factory func(opts Options) Policy
+
+// Entry is a key value pair of a policy
+type Entry struct {
+	Key    string
+	Value  Value
+	Expire time.Time // zero means never
+	index  int       // index in Expiries, -1 if not in it
+}
+
+func NewEntry(key string, value Value) *Entry {
+	return &Entry{Key: key, Value: value, index: -1}
+}
+
+// Size is the number of bytes accounted for the entry
+func (e *Entry) Size() int64 {
+	return int64(len(e.Key)) + int64(e.Value.Len())
+}
+
+// Expired reports whether the entry has expired at now
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expire.IsZero() && !now.Before(e.Expire)
+}
+
+// Expiries is a min-heap of the entries having an expiration, the soonest first
+type Expiries struct {
+	h expiryHeap
+}
+
+// Set sets the expiration of the entry and keeps track of it
+func (x *Expiries) Set(e *Entry, expire time.Time) {
+	e.Expire = expire
+	switch {
+	case e.index >= 0 && expire.IsZero():
+		heap.Remove(&x.h, e.index)
+	case e.index >= 0:
+		heap.Fix(&x.h, e.index)
+	case !expire.IsZero():
+		heap.Push(&x.h, e)
+	}
+}
+
+// Remove stops tracking the entry
+func (x *Expiries) Remove(e *Entry) {
+	if e.index >= 0 {
+		heap.Remove(&x.h, e.index)
+	}
+}
+
+// Expired returns the entry expiring first if it has expired at now
+func (x *Expiries) Expired(now time.Time) (*Entry, bool) {
+	if len(x.h) > 0 && x.h[0].Expired(now) {
+		return x.h[0], true
+	}
+	return nil, false
+}
+
+func (x *Expiries) Len() int {
+	return len(x.h)
+}
+
+type expiryHeap []*Entry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].Expire.Before(h[j].Expire) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*Entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
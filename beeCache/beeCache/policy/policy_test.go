@@ -0,0 +1,224 @@
+package policy_test
+
+import (
+	"beeCache/arc"
+	"beeCache/lfu"
+	"beeCache/lru"
+	"beeCache/policy"
+	"beeCache/tinylfu"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+var factories = []struct {
+	name string
+	new  policy.Factory
+}{
+	{"lru", lru.NewPolicy},
+	{"lfu", lfu.NewPolicy},
+	{"arc", arc.NewPolicy},
+	{"tinylfu", tinylfu.NewPolicy},
+}
+
+// TestPolicies checks the behaviour shared by all the policies
+func TestPolicies(t *testing.T) {
+	for _, f := range factories {
+		t.Run(f.name, func(t *testing.T) {
+			now := time.Now()
+			evicted, expired := 0, 0
+			p := f.new(policy.Options{
+				MaxBytes:  100,
+				OnEvicted: func(string, policy.Value) { evicted++ },
+				OnExpired: func(string, policy.Value) { expired++ },
+				Now:       func() time.Time { return now },
+			})
+			// 20 entries of 10 bytes
+			for i := 0; i < 20; i++ {
+				p.Add(fmt.Sprintf("key%02d", i), String("12345"))
+				if p.Bytes() > 100 {
+					t.Fatalf("%d bytes exceed the limit", p.Bytes())
+				}
+			}
+			if p.Bytes() != int64(p.Len())*10 || p.Len()+evicted != 20 {
+				t.Fatalf("%d entries of %d bytes with %d evicted", p.Len(), p.Bytes(), evicted)
+			}
+
+			// update an entry still cached, W-TinyLFU may not have admitted the last ones
+			key := ""
+			for i := 19; i >= 0 && key == ""; i-- {
+				if _, ok := p.Get(fmt.Sprintf("key%02d", i)); ok {
+					key = fmt.Sprintf("key%02d", i)
+				}
+			}
+			p.Add(key, String("1"))
+			if v, ok := p.Get(key); !ok || v.(String) != "1" || p.Bytes() != int64(p.Len())*10-4 {
+				t.Fatalf("update of %q failed: %v %d", key, v, p.Bytes())
+			}
+			if !p.Remove(key) || p.Remove(key) {
+				t.Fatalf("remove %q failed", key)
+			}
+			if _, ok := p.Get(key); ok {
+				t.Fatalf("%q should be removed", key)
+			}
+
+			p.AddWithExpire("exp1", String("1"), now.Add(time.Second))
+			p.AddWithExpire("exp2", String("2"), now.Add(time.Minute))
+			now = now.Add(time.Second)
+			if _, ok := p.Get("exp1"); ok {
+				t.Fatal("exp1 should be expired")
+			}
+			now = now.Add(time.Minute)
+			if n := p.RemoveExpired(10); n != 1 || expired != 2 {
+				t.Fatalf("expect exp2 removed, got %d removed and %d expired", n, expired)
+			}
+			if p.Bytes() != int64(p.Len())*10 {
+				t.Fatalf("%d entries of %d bytes", p.Len(), p.Bytes())
+			}
+		})
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	for _, f := range factories {
+		p := f.new(policy.Options{})
+		for i := 0; i < 1000; i++ {
+			p.Add(fmt.Sprintf("key%03d", i), String("12345"))
+		}
+		if p.Len() != 1000 || p.Bytes() != 11000 {
+			t.Fatalf("%s: %d entries of %d bytes", f.name, p.Len(), p.Bytes())
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	for _, f := range factories {
+		p := f.new(policy.Options{})
+		expire := time.Now().Add(time.Minute)
+		for i := 0; i < 10; i++ {
+			p.AddWithExpire(fmt.Sprintf("key%d", i), String("v"), expire)
+		}
+		p.Get("key0")
+		seen := make(map[string]bool)
+		last := ""
+		p.Range(func(e *policy.Entry) bool {
+			if seen[e.Key] || !e.Expire.Equal(expire) {
+				t.Fatalf("%s: unexpected entry %+v", f.name, e)
+			}
+			seen[e.Key] = true
+			last = e.Key
+			return true
+		})
+		// key0 is the only one used twice, it's evicted last
+		if len(seen) != 10 || last != "key0" {
+			t.Fatalf("%s: got %v, the last one is %s", f.name, seen, last)
+		}
+		n := 0
+		p.Range(func(*policy.Entry) bool {
+			n++
+			return n < 3
+		})
+		if n != 3 {
+			t.Fatalf("%s: expect Range to stop after 3 entries, got %d", f.name, n)
+		}
+	}
+}
+
+// TestScanResistance checks a frequently used working set survives a scan of one-hit keys
+func TestScanResistance(t *testing.T) {
+	for _, f := range factories[1:] {
+		p := f.new(policy.Options{MaxBytes: 1000})
+		hot := make([]string, 20) // 200 bytes
+		for i := range hot {
+			hot[i] = fmt.Sprintf("hot%02d", i)
+		}
+		for round := 0; round < 5; round++ {
+			for _, key := range hot {
+				if _, ok := p.Get(key); !ok {
+					p.Add(key, String("12345"))
+				}
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("scan%04d", i)
+			if _, ok := p.Get(key); !ok {
+				p.Add(key, String("12"))
+			}
+		}
+		kept := 0
+		for _, key := range hot {
+			if _, ok := p.Get(key); ok {
+				kept++
+			}
+		}
+		if kept < len(hot)*3/4 {
+			t.Errorf("%s: only %d of %d hot keys survived the scan", f.name, kept, len(hot))
+		}
+	}
+}
+
+// zipf returns a trace of n keys among items following a Zipf distribution
+func zipf(n, items int) []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, uint64(items-1))
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("key%d", z.Uint64())
+	}
+	return trace
+}
+
+// scan returns a Zipf trace interleaved with sequential scans of keys never seen again
+func scan(n, items int) []string {
+	trace := zipf(n, items)
+	next := 0
+	for i := 0; i < len(trace); i += 1000 {
+		for j := i; j < i+300 && j < len(trace); j++ {
+			trace[j] = fmt.Sprintf("scan%d", next)
+			next++
+		}
+	}
+	return trace
+}
+
+func hitRatio(p policy.Policy, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := p.Get(key); ok {
+			hits++
+		} else {
+			p.Add(key, String("0123456789"))
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// BenchmarkHitRatio compares the hit ratios of the policies, eg. go test -bench HitRatio -run ^$ beeCache/policy
+func BenchmarkHitRatio(b *testing.B) {
+	traces := []struct {
+		name  string
+		trace []string
+	}{
+		{"zipf", zipf(100000, 10000)},
+		{"scan", scan(100000, 10000)},
+	}
+	for _, tr := range traces {
+		for _, f := range factories {
+			b.Run(tr.name+"/"+f.name, func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					// room for about 10% of the items
+					ratio = hitRatio(f.new(policy.Options{MaxBytes: 1000 * 20}), tr.trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package beeCache
+
+import (
+	"context"
+	"fmt"
+	"github.com/blkcor/beeCache/consistentHash"
+	"sync"
+	"time"
+)
+
+// peerClient is the PeerGetter of a transport, the health checks ping it
+type peerClient interface {
+	PeerGetterWithContext
+	BatchPeerGetter
+	PeerWriter
+	ping(ctx context.Context) error
+	// close releases the connections of the client once its peer left the ring
+	close()
+}
+
+type member struct {
+	client peerClient
+	health *peerHealth
+}
+
+// ringOptions are the options shared by the pools, the zero values mean the defaults
+type ringOptions struct {
+	strategy     consistentHash.Strategy
+	replicas     int
+	maxFails     int
+	ejectTime    time.Duration
+	maxEjectTime time.Duration
+}
+
+// peerRing maps the keys to the peers skipping the ejected ones, HTTPPool and RPCPool are built on it.
+// newClient creates the client of a peer joining, it reports the results of its requests to health.
+type peerRing struct {
+	//记录本节点的地址
+	self      string
+	mu        sync.Mutex
+	peers     consistentHash.Strategy
+	members   map[string]member
+	newClient func(peer string, health *peerHealth) peerClient
+	replicas  int
+	// the health policy of the peers, see peerHealth
+	maxFails     int
+	ejectTime    time.Duration
+	maxEjectTime time.Duration
+}
+
+func newPeerRing(self string, opts ringOptions, newClient func(peer string, health *peerHealth) peerClient) *peerRing {
+	r := &peerRing{
+		self:         self,
+		peers:        opts.strategy,
+		members:      make(map[string]member),
+		newClient:    newClient,
+		replicas:     max(opts.replicas, 1),
+		maxFails:     opts.maxFails,
+		ejectTime:    opts.ejectTime,
+		maxEjectTime: opts.maxEjectTime,
+	}
+	if r.peers == nil {
+		r.peers = consistentHash.New(defaultReplicas, nil)
+	}
+	if r.maxFails <= 0 {
+		r.maxFails = defaultMaxFails
+	}
+	if r.ejectTime <= 0 {
+		r.ejectTime = defaultEjectTime
+	}
+	if r.maxEjectTime <= 0 {
+		r.maxEjectTime = defaultMaxEjectTime
+	}
+	r.maxEjectTime = max(r.maxEjectTime, r.ejectTime)
+	return r
+}
+
+// Log info with server name
+func (r *peerRing) Log(format string, v ...interface{}) {
+	fmt.Printf("[Server %s] %s\n", r.self, fmt.Sprintf(format, v...))
+}
+
+// Set sets the peers, the ones already known are kept so only the keys of the peers joining or leaving move.
+// The clients of the peers leaving are closed, the requests still using them fail.
+func (r *peerRing) Set(peers ...string) {
+	var removed []peerClient
+	// 在释放锁之后关闭离开节点的连接
+	defer func() {
+		for _, client := range removed {
+			client.close()
+		}
+	}()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wanted := make(map[string]bool, len(peers))
+	var joined, left []string
+	for _, peer := range peers {
+		wanted[peer] = true
+		if _, ok := r.members[peer]; !ok {
+			joined = append(joined, peer)
+			health := &peerHealth{maxFails: r.maxFails, ejectTime: r.ejectTime, maxEjectTime: r.maxEjectTime}
+			r.members[peer] = member{client: r.newClient(peer, health), health: health}
+		}
+	}
+	for peer := range r.members {
+		if !wanted[peer] {
+			left = append(left, peer)
+			removed = append(removed, r.members[peer].client)
+			delete(r.members, peer)
+		}
+	}
+	r.peers.Remove(left...)
+	r.peers.Add(joined...)
+	if len(joined) > 0 || len(left) > 0 {
+		r.Log("peers joined %v left %v", joined, left)
+	}
+}
+
+// Watch sets the peers given by the discovery and keeps them in sync until stop is closed
+func (r *peerRing) Watch(d Discovery, stop <-chan struct{}) error {
+	peers, err := d.Peers()
+	if err != nil {
+		return err
+	}
+	r.Set(peers...)
+	go d.Watch(func(peers []string) { r.Set(peers...) }, stop)
+	return nil
+}
+
+// PickPeer picks the first owner of the key skipping the ejected peers, none if this peer is one of the replicas
+func (r *peerRing) PickPeer(key string) (PeerGetter, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owners := r.owners(key)
+	for _, peer := range owners {
+		if peer == r.self {
+			return nil, false
+		}
+	}
+	if len(owners) == 0 {
+		return nil, false
+	}
+	r.Log("Pick peer %s", owners[0])
+	return r.members[owners[0]].client, true
+}
+
+// PickReplicas returns the replicas of the key skipping the ejected peers, this one apart
+func (r *peerRing) PickReplicas(key string) (peers []PeerGetter, self bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, peer := range r.owners(key) {
+		if peer == r.self {
+			self = true
+		} else {
+			peers = append(peers, r.members[peer].client)
+		}
+	}
+	return peers, self
+}
+
+// owners returns the first replicas healthy peers of the key on the ring, this one is always healthy.
+// All the peers seeing the same ejections agree on them.
+func (r *peerRing) owners(key string) []string {
+	now := time.Now()
+	healthy := func(peer string) bool {
+		return peer == r.self || r.members[peer].health.healthy(now)
+	}
+	owners := r.peers.GetN(key, r.replicas)
+	for i, peer := range owners {
+		if !healthy(peer) {
+			// 跳过被剔除的节点，继续沿着哈希环寻找
+			owners = owners[:i]
+			for _, peer := range r.peers.GetN(key, len(r.members))[i+1:] {
+				if len(owners) == r.replicas {
+					break
+				}
+				if healthy(peer) {
+					owners = append(owners, peer)
+				}
+			}
+			break
+		}
+	}
+	return owners
+}
+
+// Peers returns all the peers but this one and the ejected ones
+func (r *peerRing) Peers() []PeerGetter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	peers := make([]PeerGetter, 0, len(r.members))
+	for peer, m := range r.members {
+		if peer != r.self && m.health.healthy(now) {
+			peers = append(peers, m.client)
+		}
+	}
+	return peers
+}
+
+// CheckHealth pings the peers every interval, the ones failing are ejected like on the failed requests
+// and the ejected ones answering are let back at once. It stops once stop is closed.
+func (r *peerRing) CheckHealth(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.checkPeers(interval)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// checkPeers pings all the peers concurrently, each one within timeout
+func (r *peerRing) checkPeers(timeout time.Duration) {
+	r.mu.Lock()
+	members := make([]member, 0, len(r.members))
+	for peer, m := range r.members {
+		if peer != r.self {
+			members = append(members, m)
+		}
+	}
+	r.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, m := range members {
+		wg.Add(1)
+		go func(m member) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := m.client.ping(ctx); err != nil {
+				m.health.failure(time.Now())
+			} else {
+				m.health.success()
+			}
+		}(m)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,303 @@
+package beeCache
+
+import (
+	"context"
+	"fmt"
+	"github.com/blkcor/beeCache/consistentHash"
+	pb "github.com/blkcor/beeCache/proto"
+	"github.com/blkcor/beeRPC/server"
+	"github.com/blkcor/beeRPC/xclient"
+	"github.com/golang/protobuf/proto"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// rpcService is the name the peers serve PeerService under
+const rpcService = "PeerService"
+
+// RPCPool is a PeerPicker talking to the peers with beeRPC instead of HTTP. The peers are beeRPC addresses,
+// eg. tcp@10.0.0.1:8001, each one is reached through a single persistent connection multiplexing the requests.
+// Like HTTPPool, Serve accepts unauthenticated writes, the listener must only be reachable by the peers.
+type RPCPool struct {
+	*peerRing
+	xc      *xclient.XClient
+	server  *server.Server
+	timeout time.Duration
+}
+
+// RPCPoolOptions are the options of an RPCPool, they mean the same as in HTTPPoolOptions
+type RPCPoolOptions struct {
+	Strategy     consistentHash.Strategy
+	Timeout      time.Duration
+	Replicas     int
+	MaxFails     int
+	EjectTime    time.Duration
+	MaxEjectTime time.Duration
+}
+
+// NewRPCPool creates a new RPCPool instance with the options, nil means the defaults
+func NewRPCPool(self string, opts *RPCPoolOptions) *RPCPool {
+	p := &RPCPool{
+		server:  server.NewServer(),
+		timeout: defaultTimeout,
+	}
+	var ro ringOptions
+	if opts != nil {
+		if opts.Timeout > 0 {
+			p.timeout = opts.Timeout
+		}
+		ro = ringOptions{
+			strategy:     opts.Strategy,
+			replicas:     opts.Replicas,
+			maxFails:     opts.MaxFails,
+			ejectTime:    opts.EjectTime,
+			maxEjectTime: opts.MaxEjectTime,
+		}
+	}
+	// xclient 为每个节点缓存一个连接，断开后重新建立；节点由 peerRing 选择，所以它的 Discovery 用不到
+	p.xc = xclient.NewXClient(xclient.NewMultiServerDiscovery(nil), xclient.RandomSelect,
+		&server.Option{ConnectTimeout: p.timeout})
+	p.peerRing = newPeerRing(self, ro, func(peer string, health *peerHealth) peerClient {
+		return &rpcGetter{addr: peer, xc: p.xc, timeout: p.timeout, health: health}
+	})
+	_ = p.server.Register(PeerService{})
+	return p
+}
+
+// Serve serves the requests of the peers on the listener, it returns once the listener is closed
+func (p *RPCPool) Serve(lis net.Listener) {
+	p.server.Accept(lis)
+}
+
+// Close closes the connections to the peers
+func (p *RPCPool) Close() error {
+	return p.xc.Close()
+}
+
+var (
+	_ ReplicaPicker = (*RPCPool)(nil)
+	_ PeerLister    = (*RPCPool)(nil)
+)
+
+// RPCRequest is the argument of the PeerService methods: a protobuf request and the time left to the caller
+type RPCRequest struct {
+	Body          []byte
+	TimeoutMillis int64 // 0 means no deadline
+}
+
+// RPCResponse is the reply of the PeerService methods, a protobuf response
+type RPCResponse struct {
+	Body []byte
+}
+
+// PeerService serves the requests of the peers over beeRPC, its methods mirror the ones of HTTPPool.ServeHTTP
+type PeerService struct{}
+
+func (PeerService) Get(args RPCRequest, reply *RPCResponse) error {
+	in := &pb.Request{}
+	group, err := decodeRequest(args.Body, in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := args.context()
+	defer cancel()
+	// 不再转发给其他节点
+	v, err := group.getForPeer(ctx, in.Key)
+	if err != nil {
+		return err
+	}
+	return reply.encode(&pb.Response{Value: v.ByteSlice(), TtlMillis: group.ttlLeftMillis(v)})
+}
+
+func (PeerService) GetMany(args RPCRequest, reply *RPCResponse) error {
+	in := &pb.BatchRequest{}
+	group, err := decodeRequest(args.Body, in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := args.context()
+	defer cancel()
+	return reply.encode(group.batchResponse(group.getManyForPeer(ctx, in.Keys)))
+}
+
+func (PeerService) Set(args RPCRequest, reply *RPCResponse) error {
+	in := &pb.SetRequest{}
+	group, err := decodeRequest(args.Body, in)
+	if err != nil {
+		return err
+	}
+	group.setLocally(in.Key, in.Value, time.Duration(in.TtlMillis)*time.Millisecond)
+	return reply.encode(&pb.Response{})
+}
+
+func (PeerService) Remove(args RPCRequest, reply *RPCResponse) error {
+	in := &pb.Request{}
+	group, err := decodeRequest(args.Body, in)
+	if err != nil {
+		return err
+	}
+	group.removeLocally(in.Key)
+	return reply.encode(&pb.Response{})
+}
+
+func (PeerService) Invalidate(args RPCRequest, reply *RPCResponse) error {
+	in := &pb.Request{}
+	group, err := decodeRequest(args.Body, in)
+	if err != nil {
+		return err
+	}
+	group.invalidate(in.Key)
+	return reply.encode(&pb.Response{})
+}
+
+// Ping answers the health checks
+func (PeerService) Ping(args RPCRequest, reply *RPCResponse) error {
+	return nil
+}
+
+// decodeRequest decodes the body into in and returns the group it's for
+func decodeRequest(body []byte, in interface {
+	proto.Message
+	GetGroup() string
+}) (*Group, error) {
+	if err := proto.Unmarshal(body, in); err != nil {
+		return nil, fmt.Errorf("decoding request: %v", err)
+	}
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("no such cache group %s", in.GetGroup())
+	}
+	return group, nil
+}
+
+// context returns a context bounded by the time left to the caller
+func (args RPCRequest) context() (context.Context, context.CancelFunc) {
+	if args.TimeoutMillis > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(args.TimeoutMillis)*time.Millisecond)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (reply *RPCResponse) encode(out proto.Message) error {
+	body, err := proto.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("encoding response: %v", err)
+	}
+	reply.Body = body
+	return nil
+}
+
+type rpcGetter struct {
+	addr    string
+	xc      *xclient.XClient
+	timeout time.Duration // bounds the requests whose context has no deadline
+	health  *peerHealth
+	closed  atomic.Bool // set once the peer left, the getter doesn't dial it again
+}
+
+// Get gets the key with context.Background(), bounded by the timeout of the pool
+func (g *rpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *rpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.call(ctx, "Get", in, out)
+}
+
+func (g *rpcGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return g.call(ctx, "GetMany", in, out)
+}
+
+func (g *rpcGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	return g.call(ctx, "Set", in, out)
+}
+
+func (g *rpcGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.call(ctx, "Remove", in, out)
+}
+
+func (g *rpcGetter) Invalidate(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.call(ctx, "Invalidate", in, out)
+}
+
+// ping calls the Ping method of the peer
+func (g *rpcGetter) ping(ctx context.Context) error {
+	_, err := g.invoke(ctx, "Ping", RPCRequest{}, &RPCResponse{})
+	return err
+}
+
+// close closes the connection to the peer, the xclient shared by the pool would keep it otherwise
+func (g *rpcGetter) close() {
+	g.closed.Store(true)
+	_ = g.xc.CloseAddr(g.addr)
+}
+
+func (g *rpcGetter) call(ctx context.Context, method string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request: %v", err)
+	}
+	caller := ctx
+	if _, ok := ctx.Deadline(); !ok && g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	args := RPCRequest{Body: body}
+	if deadline, ok := ctx.Deadline(); ok {
+		// 0 表示没有期限，剩余时间不足1ms时也要让对方放弃
+		args.TimeoutMillis = max(time.Until(deadline).Milliseconds(), 1)
+	}
+	var reply RPCResponse
+	answered, err := g.invoke(ctx, method, args, &reply)
+	if answered {
+		g.health.report(caller, nil)
+	} else {
+		g.health.report(caller, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(reply.Body, out); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	return nil
+}
+
+// invoke calls the method of the peer, answered reports whether the peer answered, even with an error
+func (g *rpcGetter) invoke(ctx context.Context, method string, args RPCRequest, reply *RPCResponse) (answered bool, err error) {
+	if g.closed.Load() {
+		return false, fmt.Errorf("peer %s left", g.addr)
+	}
+	cli, err := g.xc.Dial(g.addr)
+	if err != nil {
+		return false, err
+	}
+	err = cli.Call(ctx, rpcService+"."+method, args, reply)
+	return err == nil || (ctx.Err() == nil && cli.IsAvailable()), err
+}
+
+var _ peerClient = (*rpcGetter)(nil)
+
+// XClientDiscovery gets the peers from a beeRPC xclient.Discovery, eg. an xclient.BeeRegistryDiscovery,
+// it's polled every interval
+type XClientDiscovery struct {
+	d        xclient.Discovery
+	interval time.Duration
+}
+
+func NewXClientDiscovery(d xclient.Discovery, interval time.Duration) *XClientDiscovery {
+	return &XClientDiscovery{d: d, interval: interval}
+}
+
+func (d *XClientDiscovery) Peers() ([]string, error) {
+	if err := d.d.Refresh(); err != nil {
+		return nil, err
+	}
+	return d.d.GetAll()
+}
+
+func (d *XClientDiscovery) Watch(update func(peers []string), stop <-chan struct{}) {
+	poll(d.Peers, d.interval, update, stop)
+}
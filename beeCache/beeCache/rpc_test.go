@@ -0,0 +1,238 @@
+package beeCache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pb "github.com/blkcor/beeCache/proto"
+	"github.com/blkcor/beeRPC/registry"
+	"github.com/blkcor/beeRPC/xclient"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveRPC starts an RPCPool serving on a local port, its address is its self
+func serveRPC(tb testing.TB, opts *RPCPoolOptions) *RPCPool {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pool := NewRPCPool("tcp@"+lis.Addr().String(), opts)
+	go pool.Serve(lis)
+	tb.Cleanup(func() {
+		lis.Close()
+		pool.Close()
+	})
+	return pool
+}
+
+func TestRPCSetRemove(t *testing.T) {
+	g := NewGroup("rpc-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("source"), nil
+	}))
+	pool := serveRPC(t, nil)
+	pool.Set(pool.self)
+	getter := &rpcGetter{addr: pool.self, xc: pool.xc}
+
+	if err := getter.Set(context.Background(), &pb.SetRequest{Group: g.name, Key: "a b", Value: []byte("v1")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	out := &pb.Response{}
+	if err := getter.GetContext(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, out); err != nil || string(out.Value) != "v1" {
+		t.Fatalf("expect v1, got %q %v", out.Value, err)
+	}
+	// the pool owns all the keys, an invalidation keeps them
+	if err := getter.Invalidate(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("a b"); !ok || v.String() != "v1" {
+		t.Fatal("the owner should keep the key")
+	}
+	if err := getter.Remove(context.Background(), &pb.Request{Group: g.name, Key: "a b"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("a b"); ok {
+		t.Fatal("the key should be removed")
+	}
+	if err := getter.ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := getter.GetContext(context.Background(), &pb.Request{Group: "rpc-none", Key: "k"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "no such cache group rpc-none") {
+		t.Fatalf("expect an unknown group, got %v", err)
+	}
+}
+
+func TestRPCGetMany(t *testing.T) {
+	db := &batchDB{}
+	g := NewGroup("rpc-many", 2<<10, db)
+	g.mainCache.add("cached", ByteView{b: []byte("hit")}, time.Time{})
+	pool := serveRPC(t, nil)
+	getter := &rpcGetter{addr: pool.self, xc: pool.xc}
+
+	out := &pb.BatchResponse{}
+	err := getter.GetMany(context.Background(), &pb.BatchRequest{Group: g.name, Keys: []string{"a", "cached", "missing"}}, out)
+	if err != nil || len(out.Results) != 3 {
+		t.Fatalf("unexpected response %v %v", out, err)
+	}
+	if string(out.Results[0].Value) != "local a" || string(out.Results[1].Value) != "hit" || out.Results[2].Error != "missing not exist" {
+		t.Fatalf("unexpected results %v", out.Results)
+	}
+	if !reflect.DeepEqual(db.batches, [][]string{{"a", "missing"}}) {
+		t.Fatalf("expect the misses loaded in one batch, got %v", db.batches)
+	}
+}
+
+func TestRPCDeadline(t *testing.T) {
+	deadlines := make(chan bool, 1)
+	NewGroup("rpc-slow", 2<<10, GetterWithContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	pool := serveRPC(t, &RPCPoolOptions{Timeout: time.Minute})
+	health := &peerHealth{maxFails: 1, ejectTime: time.Minute, maxEjectTime: time.Minute}
+	getter := &rpcGetter{addr: pool.self, xc: pool.xc, timeout: pool.timeout, health: health}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "rpc-slow", Key: "key"}, &pb.Response{}); err == nil {
+		t.Fatal("expect the deadline exceeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the request should give up after the deadline, took %v", elapsed)
+	}
+	if !<-deadlines {
+		t.Fatal("the deadline should be sent to the peer")
+	}
+	if !health.healthy(time.Now()) {
+		t.Fatal("a request given up by the caller shouldn't eject the peer")
+	}
+}
+
+func TestRPCPoolFailover(t *testing.T) {
+	pool := NewRPCPool("tcp@self", &RPCPoolOptions{MaxFails: 1, EjectTime: time.Minute})
+	defer pool.Close()
+	// nothing listens on the port 1
+	pool.Set("tcp@self", "tcp@127.0.0.1:1")
+	g := NewGroup("rpc-failover", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}), WithHotCache(0, 0))
+	g.RegisterPeers(pool)
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	if v, err := g.GetContext(context.Background(), key); err != nil || v.String() != "local" {
+		t.Fatalf("expect the value loaded locally, got %v %v", v, err)
+	}
+	if _, ok := pool.PickPeer(key); ok || len(pool.Peers()) != 0 {
+		t.Fatal("the unreachable peer should be ejected")
+	}
+}
+
+func TestRPCPoolClose(t *testing.T) {
+	NewGroup("rpc-close", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("source"), nil
+	}))
+	peer := serveRPC(t, nil)
+	pool := NewRPCPool("tcp@self", nil)
+	defer pool.Close()
+	pool.Set("tcp@self", peer.self)
+	getter := pool.Peers()[0]
+	if err := getter.Get(&pb.Request{Group: "rpc-close", Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	cli, err := pool.xc.Dial(peer.self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection to the peer leaving is closed and the getters picked before don't dial it again
+	pool.Set("tcp@self")
+	if cli.IsAvailable() {
+		t.Fatal("the connection should be closed")
+	}
+	if err := getter.Get(&pb.Request{Group: "rpc-close", Key: "k"}, &pb.Response{}); err == nil {
+		t.Fatal("the getter of the peer gone should fail")
+	}
+}
+
+func TestXClientDiscovery(t *testing.T) {
+	server := httptest.NewServer(registry.New(time.Minute))
+	defer server.Close()
+	heartbeat := func(addr string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+		req.Header.Set("X-Beerpc-Server", addr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	heartbeat("tcp@a:8001")
+
+	d := NewXClientDiscovery(xclient.NewBeeRegistryDiscovery(server.URL, time.Millisecond), time.Millisecond)
+	updates := watch(t, d)
+	waitPeers(t, updates, []string{"tcp@a:8001"})
+	heartbeat("tcp@b:8001")
+	waitPeers(t, updates, []string{"tcp@a:8001", "tcp@b:8001"})
+}
+
+// BenchmarkTransports compares the latency and the throughput of the Gets of a cached 1KB value
+// over HTTP and beeRPC, eg. go test -bench Transports -run ^$ beeCache
+func BenchmarkTransports(b *testing.B) {
+	value := bytes.Repeat([]byte("v"), 1<<10)
+	g := NewGroup("bench-transport", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	}))
+	server := httptest.NewServer(NewHTTPPool(""))
+	defer server.Close()
+	pool := serveRPC(b, nil)
+	for _, bc := range []struct {
+		name   string
+		getter peerClient
+	}{
+		{"http", &httpGetter{baseURL: server.URL + defaultBasePath}},
+		{"rpc", &rpcGetter{addr: pool.self, xc: pool.xc}},
+	} {
+		// get reports the failures with Error, Fatal can't be called by the RunParallel goroutines
+		get := func(b *testing.B) bool {
+			out := &pb.Response{}
+			if err := bc.getter.GetContext(context.Background(), &pb.Request{Group: g.name, Key: "key"}, out); err != nil || len(out.Value) != len(value) {
+				b.Errorf("unexpected value %d bytes %v", len(out.Value), err)
+				return false
+			}
+			return true
+		}
+		b.Run(bc.name+"/serial", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !get(b) {
+					return
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+		b.Run(bc.name+"/parallel", func(b *testing.B) {
+			b.RunParallel(func(p *testing.PB) {
+				for p.Next() {
+					if !get(b) {
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package beeCache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A snapshot is made of
+//
+//	header: magic "BEESNAP" | version uint16 | group name | crc32
+//	entry:  1 | key | value | expiration varint | crc32
+//	end:    0 | number of entries uvarint | crc32
+//
+// The name, keys and values are prefixed by their uvarint length, the expiration is in unix nanoseconds, 0 means never.
+// Each crc32 (Castagnoli, big endian) covers its record, the end record tells a complete snapshot from a truncated one.
+const (
+	snapshotMagic   = "BEESNAP"
+	snapshotVersion = 1
+	// maxSnapshotField bounds a key or a value, a larger length means a corrupt snapshot
+	maxSnapshotField = 1 << 30
+)
+
+const (
+	snapshotEnd byte = iota
+	snapshotEntry
+)
+
+// ErrCorruptSnapshot is returned when a snapshot fails a checksum or is truncated
+var ErrCorruptSnapshot = errors.New("beeCache: corrupt snapshot")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WithSnapshot saves a snapshot of the group to path every interval and once it's closed, an interval of 0
+// only saves on Close. LoadSnapshot restores it at startup, once the peers are registered.
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(g *Group) {
+		g.snapshotPath = path
+		g.snapshotInterval = interval
+	}
+}
+
+// WriteSnapshot writes the keys, values and expirations of the main cache to w. The hot cache isn't written,
+// its keys are owned by other peers.
+func (g *Group) WriteSnapshot(w io.Writer) error {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.New(crcTable)}
+	sw.write([]byte(snapshotMagic))
+	sw.write(binary.BigEndian.AppendUint16(nil, snapshotVersion))
+	sw.bytes([]byte(g.name))
+	sw.sum()
+
+	count := 0
+	for _, e := range g.mainCache.entries() {
+		sw.write([]byte{snapshotEntry})
+		sw.bytes([]byte(e.key))
+		sw.bytes(e.value.b)
+		var expire int64
+		if !e.expire.IsZero() {
+			expire = e.expire.UnixNano()
+		}
+		sw.varint(expire)
+		sw.sum()
+		count++
+	}
+	sw.write([]byte{snapshotEnd})
+	sw.uvarint(uint64(count))
+	sw.sum()
+	return sw.w.Flush()
+}
+
+// ReadSnapshot loads a snapshot of the group written by WriteSnapshot into the main cache. The expired entries
+// and the keys owned by another peer are skipped. It returns how many entries were loaded, those read before
+// a damaged record are kept.
+func (g *Group) ReadSnapshot(r io.Reader) (int, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(crcTable)}
+	magic := make([]byte, len(snapshotMagic))
+	sr.read(magic)
+	if sr.err == nil && string(magic) != snapshotMagic {
+		return 0, fmt.Errorf("%w: not a snapshot", ErrCorruptSnapshot)
+	}
+	version := make([]byte, 2)
+	sr.read(version)
+	name := string(sr.bytes())
+	if err := sr.check(); err != nil {
+		return 0, err
+	}
+	if v := binary.BigEndian.Uint16(version); v != snapshotVersion {
+		return 0, fmt.Errorf("beeCache: unsupported snapshot version %d", v)
+	}
+	if name != g.name {
+		return 0, fmt.Errorf("beeCache: snapshot of group %s, not %s", name, g.name)
+	}
+
+	loaded, count := 0, uint64(0)
+	now := g.now()
+	for {
+		kind := sr.byte()
+		if kind == snapshotEnd {
+			n := sr.uvarint()
+			if err := sr.check(); err != nil {
+				return loaded, err
+			}
+			if n != count {
+				return loaded, fmt.Errorf("%w: %d entries, %d expected", ErrCorruptSnapshot, count, n)
+			}
+			return loaded, nil
+		}
+		if sr.err == nil && kind != snapshotEntry {
+			return loaded, fmt.Errorf("%w: unknown record %d", ErrCorruptSnapshot, kind)
+		}
+		key, value, expire := string(sr.bytes()), sr.bytes(), sr.varint()
+		if err := sr.check(); err != nil {
+			return loaded, err
+		}
+		count++
+		var expireAt time.Time
+		if expire != 0 {
+			expireAt = time.Unix(0, expire)
+		}
+		if !expireAt.IsZero() && !now.Before(expireAt) {
+			continue
+		}
+		// 只保留仍然属于本节点的key
+		if _, ok := g.pickPeer(key); ok {
+			continue
+		}
+		g.mainCache.add(key, ByteView{b: value}, expireAt)
+		loaded++
+	}
+}
+
+// SaveSnapshot writes a snapshot to a temporary file renamed to path once synced, so path always holds
+// a complete snapshot
+func (g *Group) SaveSnapshot(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = g.WriteSnapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshot reads the snapshot saved at path, see ReadSnapshot
+func (g *Group) LoadSnapshot(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return g.ReadSnapshot(f)
+}
+
+// snapshotter saves a snapshot every interval, and a last one once stop is closed
+func (g *Group) snapshotter(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-stop:
+			if err := g.SaveSnapshot(g.snapshotPath); err != nil {
+				log.Println("[BeeCache] Failed to save snapshot:", err)
+			}
+			return
+		}
+		if err := g.SaveSnapshot(g.snapshotPath); err != nil {
+			log.Println("[BeeCache] Failed to save snapshot:", err)
+		}
+	}
+}
+
+// snapshotWriter writes the records and their checksums, the errors are reported by Flush
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+}
+
+func (w *snapshotWriter) write(p []byte) {
+	w.w.Write(p)
+	w.crc.Write(p)
+}
+
+func (w *snapshotWriter) uvarint(x uint64) {
+	w.write(binary.AppendUvarint(nil, x))
+}
+
+func (w *snapshotWriter) varint(x int64) {
+	w.write(binary.AppendVarint(nil, x))
+}
+
+func (w *snapshotWriter) bytes(p []byte) {
+	w.uvarint(uint64(len(p)))
+	w.write(p)
+}
+
+// sum ends the record with its checksum
+func (w *snapshotWriter) sum() {
+	w.w.Write(binary.BigEndian.AppendUint32(nil, w.crc.Sum32()))
+	w.crc.Reset()
+}
+
+// snapshotReader reads the records and their checksums, the first error is kept and reported by check
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (r *snapshotReader) read(p []byte) {
+	if r.err != nil {
+		return
+	}
+	if _, r.err = io.ReadFull(r.r, p); r.err == nil {
+		r.crc.Write(p)
+	}
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b := []byte{0}
+	r.read(b)
+	return b[0], r.err
+}
+
+func (r *snapshotReader) byte() byte {
+	b, _ := r.ReadByte()
+	return b
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(r)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return x
+}
+
+func (r *snapshotReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	x, err := binary.ReadVarint(r)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return x
+}
+
+func (r *snapshotReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > maxSnapshotField {
+		r.err = fmt.Errorf("%w: field of %d bytes", ErrCorruptSnapshot, n)
+		return nil
+	}
+	b := make([]byte, n)
+	r.read(b)
+	return b
+}
+
+// check reads the checksum ending the record
+func (r *snapshotReader) check() error {
+	sum := r.crc.Sum32()
+	b := make([]byte, 4)
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+	r.crc.Reset()
+	switch {
+	case errors.Is(r.err, io.EOF), errors.Is(r.err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: truncated", ErrCorruptSnapshot)
+	case r.err != nil:
+		return r.err
+	case binary.BigEndian.Uint32(b) != sum:
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package beeCache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	src := NewGroup("snap", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v " + key), nil
+	}), WithClock(clock))
+	src.setLocally("forever", []byte("1"), -1)
+	src.setLocally("short", []byte("2"), time.Second)
+	src.setLocally("long", []byte("3"), time.Hour)
+	src.setLocally("remote", []byte("4"), -1)
+	src.setLocally("empty", nil, -1)
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted peer no longer owns the keys starting with r, and short has expired meanwhile
+	now = now.Add(time.Minute)
+	dst := NewGroup("snap", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("should be restored")
+	}), WithClock(clock))
+	dst.RegisterPeers(prefixPicker{&fakePeer{}})
+	n, err := dst.ReadSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 3 {
+		t.Fatalf("expect 3 entries loaded, got %d %v", n, err)
+	}
+	for key, want := range map[string]string{"forever": "1", "long": "3", "empty": ""} {
+		if v, ok := dst.mainCache.get(key); !ok || v.String() != want {
+			t.Fatalf("expect %s restored, got %q %v", key, v, ok)
+		}
+	}
+	for _, key := range []string{"short", "remote"} {
+		if _, ok := dst.mainCache.get(key); ok {
+			t.Fatalf("%s shouldn't be restored", key)
+		}
+	}
+	// the ttl is kept
+	now = now.Add(time.Hour)
+	if _, ok := dst.mainCache.get("long"); ok {
+		t.Fatal("long should expire")
+	}
+
+	other := NewGroup("snap-other", 2<<10, dst.getter)
+	if _, err := other.ReadSnapshot(bytes.NewReader(buf.Bytes())); err == nil || errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expect the snapshot of another group refused, got %v", err)
+	}
+}
+
+func TestCorruptSnapshot(t *testing.T) {
+	src := NewGroup("snap-corrupt", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("not found")
+	}))
+	for _, key := range []string{"a", "b", "c"} {
+		src.setLocally(key, []byte("value of "+key), -1)
+	}
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// a bit of the last entry flipped
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-10] ^= 1
+
+	for name, damaged := range map[string][]byte{
+		"empty":     {},
+		"truncated": data[:len(data)-3],
+		"flipped":   flipped,
+		"garbage":   []byte("not a snapshot at all"),
+	} {
+		dst := NewGroup("snap-corrupt", 2<<10, src.getter)
+		n, err := dst.ReadSnapshot(bytes.NewReader(damaged))
+		if !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("%s: expect a corrupt snapshot, got %v", name, err)
+		}
+		if int64(n) != dst.CacheStats(MainCache).Items {
+			t.Fatalf("%s: %d entries loaded but %d cached", name, n, dst.CacheStats(MainCache).Items)
+		}
+	}
+}
+
+func TestWithSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.snap")
+	g := NewGroup("snap-file", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v " + key), nil
+	}), WithSnapshot(path, time.Millisecond))
+	g.GetContext(context.Background(), "Tom")
+	deadline := time.After(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("the snapshot should be saved periodically")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	g.GetContext(context.Background(), "Jack")
+	g.Close()
+
+	restarted := NewGroup("snap-file", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("should be restored")
+	}))
+	if n, err := restarted.LoadSnapshot(path); err != nil || n != 2 {
+		t.Fatalf("expect the last snapshot saved on Close, got %d %v", n, err)
+	}
+	if v, err := restarted.GetContext(context.Background(), "Jack"); err != nil || v.String() != "v Jack" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+	if matches, _ := filepath.Glob(path + ".tmp*"); len(matches) != 0 {
+		t.Fatalf("the temporary files should be removed, got %v", matches)
+	}
+}
@@ -0,0 +1,135 @@
+package beeCache
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Stats are the statistics of a Group
+type Stats struct {
+	Gets           int64 `json:"gets"`            // the keys asked, by the callers and the peers
+	Hits           int64 `json:"hits"`            // the keys found in the main or the hot cache
+	Misses         int64 `json:"misses"`          // the keys not cached
+	Loads          int64 `json:"loads"`           // the misses loaded, from a peer or locally
+	LoadsDeduped   int64 `json:"loads_deduped"`   // the loads run once the concurrent ones of a key are merged
+	PeerLoads      int64 `json:"peer_loads"`      // the keys got from a peer
+	PeerErrors     int64 `json:"peer_errors"`     // the keys a peer failed to give
+	LocalLoads     int64 `json:"local_loads"`     // the keys got from the Getter
+	LocalLoadErrs  int64 `json:"local_load_errs"` // the keys the Getter failed to give
+	ServerRequests int64 `json:"server_requests"` // the keys asked by the peers
+
+	Main CacheStats `json:"main_cache"`
+	Hot  CacheStats `json:"hot_cache"`
+}
+
+type groupStats struct {
+	gets           atomic.Int64
+	hits           atomic.Int64
+	misses         atomic.Int64
+	loads          atomic.Int64
+	loadsDeduped   atomic.Int64
+	peerLoads      atomic.Int64
+	peerErrors     atomic.Int64
+	localLoads     atomic.Int64
+	localLoadErrs  atomic.Int64
+	serverRequests atomic.Int64
+}
+
+// Stats returns the statistics of the group and its caches
+func (g *Group) Stats() Stats {
+	return Stats{
+		Gets:           g.stats.gets.Load(),
+		Hits:           g.stats.hits.Load(),
+		Misses:         g.stats.misses.Load(),
+		Loads:          g.stats.loads.Load(),
+		LoadsDeduped:   g.stats.loadsDeduped.Load(),
+		PeerLoads:      g.stats.peerLoads.Load(),
+		PeerErrors:     g.stats.peerErrors.Load(),
+		LocalLoads:     g.stats.localLoads.Load(),
+		LocalLoadErrs:  g.stats.localLoadErrs.Load(),
+		ServerRequests: g.stats.serverRequests.Load(),
+		Main:           g.mainCache.stats(),
+		Hot:            g.hotCache.stats(),
+	}
+}
+
+// AllStats returns the statistics of all the groups by name
+func AllStats() map[string]Stats {
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+	stats := make(map[string]Stats, len(all))
+	for _, g := range all {
+		stats[g.name] = g.Stats()
+	}
+	return stats
+}
+
+type groupMetric struct {
+	name, help, typ string
+	value           func(s Stats) int64
+}
+
+type cacheMetric struct {
+	name, help, typ string
+	value           func(s CacheStats) int64
+}
+
+var groupMetrics = []groupMetric{
+	{"beecache_gets_total", "Keys asked by the callers and the peers.", "counter", func(s Stats) int64 { return s.Gets }},
+	{"beecache_hits_total", "Keys found in the main or the hot cache.", "counter", func(s Stats) int64 { return s.Hits }},
+	{"beecache_misses_total", "Keys not cached.", "counter", func(s Stats) int64 { return s.Misses }},
+	{"beecache_loads_total", "Misses loaded from a peer or locally.", "counter", func(s Stats) int64 { return s.Loads }},
+	{"beecache_loads_deduped_total", "Loads run once the concurrent ones of a key are merged.", "counter", func(s Stats) int64 { return s.LoadsDeduped }},
+	{"beecache_peer_loads_total", "Keys got from a peer.", "counter", func(s Stats) int64 { return s.PeerLoads }},
+	{"beecache_peer_errors_total", "Keys a peer failed to give.", "counter", func(s Stats) int64 { return s.PeerErrors }},
+	{"beecache_local_loads_total", "Keys got from the Getter.", "counter", func(s Stats) int64 { return s.LocalLoads }},
+	{"beecache_local_load_errors_total", "Keys the Getter failed to give.", "counter", func(s Stats) int64 { return s.LocalLoadErrs }},
+	{"beecache_server_requests_total", "Keys asked by the peers.", "counter", func(s Stats) int64 { return s.ServerRequests }},
+}
+
+var cacheMetrics = []cacheMetric{
+	{"beecache_cache_bytes", "Size of the keys and values of the cache.", "gauge", func(s CacheStats) int64 { return s.Bytes }},
+	{"beecache_cache_items", "Entries of the cache.", "gauge", func(s CacheStats) int64 { return s.Items }},
+	{"beecache_cache_gets_total", "Lookups of the cache.", "counter", func(s CacheStats) int64 { return s.Gets }},
+	{"beecache_cache_hits_total", "Lookups of the cache finding the key.", "counter", func(s CacheStats) int64 { return s.Hits }},
+	{"beecache_cache_evictions_total", "Entries evicted to make room.", "counter", func(s CacheStats) int64 { return s.Evictions }},
+	{"beecache_cache_expirations_total", "Expired entries removed.", "counter", func(s CacheStats) int64 { return s.Expirations }},
+}
+
+// WritePrometheus writes the statistics of the groups in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, stats map[string]Stats) error {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, m := range groupMetrics {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, name := range names {
+			fmt.Fprintf(&sb, "%s{group=\"%s\"} %d\n", m.name, escapeLabel(name), m.value(stats[name]))
+		}
+	}
+	for _, m := range cacheMetrics {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, name := range names {
+			s := stats[name]
+			fmt.Fprintf(&sb, "%s{group=\"%s\",cache=\"main\"} %d\n", m.name, escapeLabel(name), m.value(s.Main))
+			fmt.Fprintf(&sb, "%s{group=\"%s\",cache=\"hot\"} %d\n", m.name, escapeLabel(name), m.value(s.Hot))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,68 @@
+package tinylfu
+
+import "hash/maphash"
+
+const (
+	sketchDepth = 4
+	maxCounter  = 15
+)
+
+// sketch is a count-min sketch estimating the access frequency of the keys, its counters saturate at 15.
+// The counters are halved once samples accesses are recorded, so the old frequencies fade away.
+type sketch struct {
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	seeds   [sketchDepth]maphash.Seed
+	added   int
+	samples int
+}
+
+// newSketch creates a sketch of width counters per row, rounded up to a power of 2
+func newSketch(width int) *sketch {
+	w := 16
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), samples: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+		s.seeds[i] = maphash.MakeSeed()
+	}
+	return s
+}
+
+func (s *sketch) index(i int, key string) uint64 {
+	return maphash.String(s.seeds[i], key) & s.mask
+}
+
+// increment records an access of the key
+func (s *sketch) increment(key string) {
+	for i := range s.rows {
+		if idx := s.index(i, key); s.rows[i][idx] < maxCounter {
+			s.rows[i][idx]++
+		}
+	}
+	s.added++
+	if s.added >= s.samples {
+		s.reset()
+	}
+}
+
+// estimate returns the estimated frequency of the key, the lowest of its counters
+func (s *sketch) estimate(key string) uint8 {
+	n := uint8(maxCounter)
+	for i := range s.rows {
+		n = min(n, s.rows[i][s.index(i, key)])
+	}
+	return n
+}
+
+// reset halves all the counters
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.added /= 2
+}
@@ -0,0 +1,259 @@
+// Package tinylfu implements W-TinyLFU: new entries enter a small LRU window, the ones leaving it compete
+// with the victim of the main SLRU cache and are only admitted if a count-min sketch says they're accessed more.
+// A scan of one-hit keys therefore only churns the window.
+package tinylfu
+
+import (
+	"beeCache/policy"
+	"container/list"
+	"time"
+)
+
+const (
+	windowPercent    = 1
+	protectedPercent = 80
+	minCounters      = 64
+	maxCounters      = 1 << 20
+	bytesPerCounter  = 64 // estimated size of an entry to size the sketch
+)
+
+type Value = policy.Value
+
+// Cache is a W-TinyLFU cache
+type Cache struct {
+	maxBytes       int64
+	windowBytes    int64
+	protectedBytes int64
+	window         *segment
+	probation      *segment
+	protected      *segment
+	cache          map[string]*list.Element
+	sketch         *sketch
+	expiries       policy.Expiries
+	// OnEvicted is called when an entry is evicted to make room or isn't admitted
+	OnEvicted func(key string, value Value)
+	// OnExpired is called when an expired entry is removed
+	OnExpired func(key string, value Value)
+	// Now is the clock deciding the expiration, time.Now by default
+	Now func() time.Time
+}
+
+// segment is a LRU list with its size, the most recently used at front
+type segment struct {
+	ll     *list.List
+	nBytes int64
+}
+
+type item struct {
+	*policy.Entry
+	seg *segment
+}
+
+func newSegment() *segment {
+	return &segment{ll: list.New()}
+}
+
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	windowBytes := maxBytes * windowPercent / 100
+	return &Cache{
+		maxBytes:       maxBytes,
+		windowBytes:    windowBytes,
+		protectedBytes: (maxBytes - windowBytes) * protectedPercent / 100,
+		window:         newSegment(),
+		probation:      newSegment(),
+		protected:      newSegment(),
+		cache:          make(map[string]*list.Element),
+		sketch:         newSketch(int(min(max(maxBytes/bytesPerCounter, minCounters), maxCounters))),
+		OnEvicted:      onEvicted,
+		Now:            time.Now,
+	}
+}
+
+var _ policy.AccessRecorder = (*Cache)(nil)
+
+// NewPolicy creates a Cache as a policy.Policy
+func NewPolicy(opts policy.Options) policy.Policy {
+	c := New(opts.MaxBytes, opts.OnEvicted)
+	c.OnExpired = opts.OnExpired
+	if opts.Now != nil {
+		c.Now = opts.Now
+	}
+	return c
+}
+
+// Get returns the value and records the access, an expired entry is removed
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	c.sketch.increment(key)
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	it := ele.Value.(*item)
+	if it.Expired(c.Now()) {
+		c.removeElement(ele)
+		if c.OnExpired != nil {
+			c.OnExpired(it.Key, it.Value)
+		}
+		return nil, false
+	}
+	c.hit(ele)
+	return it.Value, true
+}
+
+// RecordAccess records an access of the key in the sketch, the entry isn't promoted
+func (c *Cache) RecordAccess(key string) {
+	c.sketch.increment(key)
+}
+
+// hit moves the entry to the front of its segment, an entry on probation is protected
+func (c *Cache) hit(ele *list.Element) {
+	it := ele.Value.(*item)
+	if it.seg != c.probation {
+		it.seg.ll.MoveToFront(ele)
+		return
+	}
+	c.move(ele, c.protected)
+	// demote the least recently used protected entries
+	for c.protected.nBytes > c.protectedBytes && c.protected.ll.Len() > 1 {
+		c.move(c.protected.ll.Back(), c.probation)
+	}
+}
+
+// move moves the entry to the front of seg
+func (c *Cache) move(ele *list.Element, seg *segment) {
+	it := ele.Value.(*item)
+	it.seg.ll.Remove(ele)
+	it.seg.nBytes -= it.Size()
+	it.seg = seg
+	seg.nBytes += it.Size()
+	c.cache[it.Key] = seg.ll.PushFront(it)
+}
+
+// Peek returns the entry without recording the access, an expired entry is returned as is
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*item)
+		return e.Value, e.Expire, true
+	}
+	return
+}
+
+// Add adds an entry which never expires
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds an entry expiring at expire, updating an entry counts as an access
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		c.sketch.increment(key)
+		it := ele.Value.(*item)
+		it.seg.nBytes += int64(value.Len()) - int64(it.Value.Len())
+		it.Value = value
+		c.expiries.Set(it.Entry, expire)
+		c.hit(ele)
+	} else {
+		it := &item{Entry: policy.NewEntry(key, value), seg: c.window}
+		c.window.nBytes += it.Size()
+		c.cache[key] = c.window.ll.PushFront(it)
+		c.expiries.Set(it.Entry, expire)
+	}
+	c.evict()
+}
+
+// evict moves the entries overflowing the window to probation, then evicts the entries overflowing the cache:
+// the candidate coming from the window is compared with the victim of probation, the less frequent one goes
+func (c *Cache) evict() {
+	if c.maxBytes == 0 {
+		return
+	}
+	var candidates []*list.Element
+	for c.window.nBytes > c.windowBytes && c.window.ll.Len() > 0 {
+		ele := c.window.ll.Back()
+		c.move(ele, c.probation)
+		candidates = append(candidates, c.cache[ele.Value.(*item).Key])
+	}
+	for c.Bytes() > c.maxBytes {
+		victim := c.probation.ll.Back()
+		if victim == nil {
+			victim = c.protected.ll.Back()
+		}
+		if victim == nil {
+			victim = c.window.ll.Back()
+		}
+		// the candidates are at the front of probation, the victim is evicted if it's less frequent than one
+		for len(candidates) > 0 && candidates[0].Value.(*item).seg == nil {
+			candidates = candidates[1:]
+		}
+		if len(candidates) > 0 && candidates[0] != victim {
+			candidate := candidates[0].Value.(*item)
+			if c.sketch.estimate(candidate.Key) <= c.sketch.estimate(victim.Value.(*item).Key) {
+				victim = candidates[0]
+			}
+		}
+		c.evictElement(victim)
+	}
+}
+
+func (c *Cache) evictElement(ele *list.Element) {
+	it := ele.Value.(*item)
+	c.removeElement(ele)
+	if c.OnEvicted != nil {
+		c.OnEvicted(it.Key, it.Value)
+	}
+}
+
+// Range calls fn for the entries of the window, probation then protected, each one from the least recently used,
+// until it returns false
+func (c *Cache) Range(fn func(e *policy.Entry) bool) {
+	for _, s := range []*segment{c.window, c.probation, c.protected} {
+		for ele := s.ll.Back(); ele != nil; ele = ele.Prev() {
+			if !fn(ele.Value.(*item).Entry) {
+				return
+			}
+		}
+	}
+}
+
+// Remove removes the key, no callback is called
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes at most limit expired entries, it returns how many were removed
+func (c *Cache) RemoveExpired(limit int) int {
+	n := 0
+	for ; n < limit; n++ {
+		e, ok := c.expiries.Expired(c.Now())
+		if !ok {
+			break
+		}
+		c.removeElement(c.cache[e.Key])
+		if c.OnExpired != nil {
+			c.OnExpired(e.Key, e.Value)
+		}
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	it := ele.Value.(*item)
+	it.seg.ll.Remove(ele)
+	it.seg.nBytes -= it.Size()
+	it.seg = nil
+	delete(c.cache, it.Key)
+	c.expiries.Remove(it.Entry)
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the size of the keys and values
+func (c *Cache) Bytes() int64 {
+	return c.window.nBytes + c.probation.nBytes + c.protected.nBytes
+}
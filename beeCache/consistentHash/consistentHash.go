@@ -9,20 +9,42 @@ import (
 // Hash maps bytes to uint32
 type Hash func([]byte) uint32
 
-// Map contains all hashed keys
+// Strategy maps the keys to the nodes, it isn't safe for concurrent use
+type Strategy interface {
+	// Add adds nodes of weight 1
+	Add(nodes ...string)
+	// AddWeighted adds a node owning about weight times the keys of a node of weight 1
+	AddWeighted(node string, weight int)
+	Remove(nodes ...string)
+	// Get returns the node owning the key, "" if there's none
+	Get(key string) string
+	// GetN returns up to n distinct nodes for the key, the owner first, eg. to replicate it
+	GetN(key string, n int) []string
+}
+
+// Map contains all hashed keys, it's a ring of virtual nodes
 type Map struct {
 	hash     Hash
 	replicas int
-	keys     []int // Sorted
-	hashMap  map[int]string
+	ring     []vnode // sorted by hash then by node
+	weights  map[string]int
+}
+
+// vnode is a virtual node, the nodes colliding on a hash are all kept and ordered by name
+// so the owner of a key doesn't depend on the order the nodes were added
+type vnode struct {
+	hash uint32
+	node string
 }
 
+var _ Strategy = (*Map)(nil)
+
 // New creates a Map instance
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		hash:     fn,
 		replicas: replicas,
-		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		//default hash function
@@ -34,24 +56,97 @@ func New(replicas int, fn Hash) *Map {
 // Add adds some keys to the hash
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.add(key, 1)
+	}
+	m.sort()
+}
+
+// AddWeighted adds a key with weight times the replicas, a key already added gets the new weight
+func (m *Map) AddWeighted(key string, weight int) {
+	m.add(key, weight)
+	m.sort()
+}
+
+func (m *Map) add(key string, weight int) {
+	if _, ok := m.weights[key]; ok {
+		m.Remove(key)
+	}
+	if weight <= 0 {
+		return
+	}
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		m.ring = append(m.ring, vnode{hash: m.hash([]byte(strconv.Itoa(i) + key)), node: key})
+	}
+}
+
+func (m *Map) sort() {
+	sort.Slice(m.ring, func(i, j int) bool {
+		if m.ring[i].hash != m.ring[j].hash {
+			return m.ring[i].hash < m.ring[j].hash
+		}
+		return m.ring[i].node < m.ring[j].node
+	})
+}
+
+// Remove removes some keys from the hash, the hashed keys of the others are kept
+// so only the data of the removed keys moves
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		removed[key] = true
+		delete(m.weights, key)
+	}
+	ring := m.ring[:0]
+	for _, v := range m.ring {
+		if !removed[v.node] {
+			ring = append(ring, v)
 		}
 	}
-	sort.Ints(m.keys)
+	m.ring = ring
+}
+
+// search returns the index of the first virtual node at or after the hash of the key
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= hash
+	})
+	return idx % len(m.ring)
 }
 
+// Get gets the closest item in the hash to the provided key
 func (m *Map) Get(key string) string {
-	if len(m.keys) == 0 {
+	if len(m.ring) == 0 {
 		return ""
 	}
-	// calculate the hash of the key
-	hash := int(m.hash([]byte(key)))
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
-	})
+	return m.ring[m.search(key)].node
+}
+
+// GetN walks the ring from the key and returns the first n distinct keys
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.ring) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(m.weights))
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i, idx := 0, m.search(key); i < len(m.ring) && len(nodes) < n; i++ {
+		node := m.ring[(idx+i)%len(m.ring)].node
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+// mix64 spreads the bits of a hash, it's the finalizer of splitmix64
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
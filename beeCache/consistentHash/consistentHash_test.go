@@ -40,3 +40,64 @@ func TestConsistentHash(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	hash.Remove("4")
+
+	// 4, 14, 24 are gone, their keys move to the next replicas
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"11": "2",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	hash.Remove("6", "2")
+	if hash.Get("2") != "" {
+		t.Errorf("an empty hash should yield nothing")
+	}
+}
+
+func TestMinimalRemapping(t *testing.T) {
+	peers := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001"}
+	hash := New(50, nil)
+	hash.Add(peers...)
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = hash.Get(key)
+	}
+
+	// a joining peer only takes keys, the others keep theirs
+	hash.Add("http://10.0.0.4:8001")
+	moved := 0
+	for key, owner := range before {
+		if now := hash.Get(key); now != owner {
+			if now != "http://10.0.0.4:8001" {
+				t.Fatalf("%s moved from %s to %s", key, owner, now)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 4000 {
+		t.Fatalf("expect about a quarter of the keys moved, got %d", moved)
+	}
+
+	// leaving again restores the previous owners
+	hash.Remove("http://10.0.0.4:8001")
+	for key, owner := range before {
+		if now := hash.Get(key); now != owner {
+			t.Fatalf("%s should be back on %s, got %s", key, owner, now)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package consistentHash
+
+import (
+	"hash/crc32"
+	"slices"
+)
+
+// Jump is the jump consistent hash of Lamping and Veach: no memory per key nor virtual node and a perfect balance,
+// but the nodes are numbered buckets. Adding a node or removing the last one added only moves its keys,
+// removing another one renumbers the buckets after it and moves many more.
+type Jump struct {
+	hash    Hash
+	buckets []string // a node of weight w has w consecutive buckets
+}
+
+var _ Strategy = (*Jump)(nil)
+
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Jump{hash: fn}
+}
+
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		j.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted appends weight buckets for the node, a node already added is removed first
+func (j *Jump) AddWeighted(node string, weight int) {
+	j.Remove(node)
+	for i := 0; i < weight; i++ {
+		j.buckets = append(j.buckets, node)
+	}
+}
+
+func (j *Jump) Remove(nodes ...string) {
+	j.buckets = slices.DeleteFunc(j.buckets, func(b string) bool {
+		return slices.Contains(nodes, b)
+	})
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.buckets))]
+}
+
+// GetN rehashes the key until it gets n distinct nodes, the remaining ones are taken in bucket order
+// if it takes too long
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.buckets) == 0 || n <= 0 {
+		return nil
+	}
+	var nodes []string
+	h := mix64(uint64(j.hash([]byte(key))))
+	for i := 0; i < 4*len(j.buckets) && len(nodes) < n; i++ {
+		if node := j.buckets[jumpHash(h, len(j.buckets))]; !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+		h = mix64(h)
+	}
+	for _, node := range j.buckets {
+		if len(nodes) >= n {
+			break
+		}
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// jumpHash returns the bucket in [0, buckets) of the key
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
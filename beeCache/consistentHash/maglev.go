@@ -0,0 +1,150 @@
+package consistentHash
+
+import (
+	"hash/crc32"
+	"slices"
+)
+
+// DefaultMaglevSize is the default size of the lookup table, a prime much bigger than the number of nodes
+const DefaultMaglevSize = 65537
+
+// Maglev is the hashing of Google's Maglev load balancer: each node fills the slots of a lookup table following
+// its own permutation, taking turns so they get an equal share. The lookup is O(1) and the balance near perfect,
+// a membership change moves slightly more keys than the ring, and the table is rebuilt in O(size).
+type Maglev struct {
+	hash    Hash
+	size    uint64
+	weights map[string]int
+	nodes   []string // sorted, so the table doesn't depend on the order the nodes were added
+	table   []int    // index in nodes of the owner of each slot
+}
+
+var _ Strategy = (*Maglev)(nil)
+
+// NewMaglev creates a Maglev with a table of size slots, DefaultMaglevSize if 0.
+// The permutations only cover the table if its size is a prime, size is rounded up to the next one.
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevSize
+	}
+	size = nextPrime(size)
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Maglev{hash: fn, size: uint64(size), weights: make(map[string]int)}
+}
+
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		m.weights[node] = 1
+	}
+	m.populate()
+}
+
+// AddWeighted adds a node filling weight slots at each turn
+func (m *Maglev) AddWeighted(node string, weight int) {
+	if weight <= 0 {
+		delete(m.weights, node)
+	} else {
+		m.weights[node] = weight
+	}
+	m.populate()
+}
+
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(m.weights, node)
+	}
+	m.populate()
+}
+
+// populate rebuilds the lookup table
+func (m *Maglev) populate() {
+	m.nodes = m.nodes[:0]
+	for node := range m.weights {
+		m.nodes = append(m.nodes, node)
+	}
+	slices.Sort(m.nodes)
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+	// the permutation of a node is offset, offset+skip, offset+2*skip... modulo size
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		h := mix64(uint64(m.hash([]byte(node))))
+		offsets[i] = h % m.size
+		skips[i] = (h>>32)%(m.size-1) + 1
+	}
+	m.table = make([]int, m.size)
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	for filled := uint64(0); ; {
+		for i, node := range m.nodes {
+			for w := 0; w < m.weights[node]; w++ {
+				slot := (offsets[i] + next[i]*skips[i]) % m.size
+				for m.table[slot] >= 0 {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				m.table[slot] = i
+				next[i]++
+				if filled++; filled == m.size {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Maglev) slot(key string) uint64 {
+	return mix64(uint64(m.hash([]byte(key)))) % m.size
+}
+
+func (m *Maglev) Get(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[m.slot(key)]]
+}
+
+// GetN walks the table from the slot of the key and returns the first n distinct nodes
+func (m *Maglev) GetN(key string, n int) []string {
+	if len(m.table) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(m.nodes))
+	nodes := make([]string, 0, n)
+	slot := m.slot(key)
+	for i := uint64(0); i < m.size && len(nodes) < n; i++ {
+		if node := m.nodes[m.table[(slot+i)%m.size]]; !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// nextPrime returns the smallest prime >= n, 2 if n is smaller
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	if n%2 == 0 {
+		n++
+	}
+	for ; ; n += 2 {
+		prime := true
+		for d := 3; d*d <= n; d += 2 {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
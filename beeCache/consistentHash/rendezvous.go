@@ -0,0 +1,90 @@
+package consistentHash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous is the highest random weight hashing: each node scores the key and the highest score owns it.
+// Removing a node only moves its keys, but a lookup is O(nodes).
+type Rendezvous struct {
+	hash  Hash
+	nodes map[string]rendezvousNode
+}
+
+type rendezvousNode struct {
+	hash   uint64
+	weight float64
+}
+
+var _ Strategy = (*Rendezvous)(nil)
+
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{hash: fn, nodes: make(map[string]rendezvousNode)}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight <= 0 {
+		r.Remove(node)
+		return
+	}
+	r.nodes[node] = rendezvousNode{hash: mix64(uint64(r.hash([]byte(node)))), weight: float64(weight)}
+}
+
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+}
+
+// score is weight / -ln(u) for a uniform u in (0, 1) drawn from the key and the node,
+// so a node gets a share of the keys proportional to its weight
+func (n rendezvousNode) score(keyHash uint64) float64 {
+	h := mix64(keyHash ^ n.hash)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return n.weight / -math.Log(u)
+}
+
+func (r *Rendezvous) Get(key string) string {
+	keyHash := uint64(r.hash([]byte(key)))
+	var owner string
+	best := -1.0
+	for node, n := range r.nodes {
+		// ties are broken by name so the owner doesn't depend on the map order
+		if s := n.score(keyHash); s > best || (s == best && node < owner) {
+			owner, best = node, s
+		}
+	}
+	return owner
+}
+
+// GetN returns the n nodes of highest score
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	keyHash := uint64(r.hash([]byte(key)))
+	nodes := make([]string, 0, len(r.nodes))
+	scores := make(map[string]float64, len(r.nodes))
+	for node, rn := range r.nodes {
+		nodes = append(nodes, node)
+		scores[node] = rn.score(keyHash)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if scores[nodes[i]] != scores[nodes[j]] {
+			return scores[nodes[i]] > scores[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	return nodes[:min(n, len(nodes))]
+}
@@ -0,0 +1,197 @@
+package consistentHash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+var strategies = []struct {
+	name string
+	new  func() Strategy
+}{
+	{"ring", func() Strategy { return New(160, nil) }},
+	{"jump", func() Strategy { return NewJump(nil) }},
+	{"rendezvous", func() Strategy { return NewRendezvous(nil) }},
+	{"maglev", func() Strategy { return NewMaglev(0, nil) }},
+}
+
+func nodeNames(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i+1)
+	}
+	return nodes
+}
+
+const balanceKeys = 100000
+
+func owners(s Strategy) map[string]string {
+	owners := make(map[string]string, balanceKeys)
+	for i := 0; i < balanceKeys; i++ {
+		key := "key" + strconv.Itoa(i)
+		owners[key] = s.Get(key)
+	}
+	return owners
+}
+
+func TestBalance(t *testing.T) {
+	// the largest share over the mean
+	maxSkew := map[string]float64{"ring": 1.25, "jump": 1.05, "rendezvous": 1.05, "maglev": 1.05}
+	for _, st := range strategies {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new()
+			nodes := nodeNames(10)
+			s.Add(nodes...)
+			counts := make(map[string]int)
+			for _, owner := range owners(s) {
+				counts[owner]++
+			}
+			mean := float64(balanceKeys) / float64(len(nodes))
+			var sq float64
+			skew := 0.0
+			for _, node := range nodes {
+				d := float64(counts[node]) - mean
+				sq += d * d
+				skew = max(skew, float64(counts[node])/mean)
+			}
+			t.Logf("max/mean %.3f stddev/mean %.3f", skew, math.Sqrt(sq/float64(len(nodes)))/mean)
+			if skew > maxSkew[st.name] {
+				t.Fatalf("unbalanced %v", counts)
+			}
+		})
+	}
+}
+
+func TestWeights(t *testing.T) {
+	for _, st := range strategies {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new()
+			s.Add("a", "b")
+			s.AddWeighted("c", 2)
+			counts := make(map[string]int)
+			for _, owner := range owners(s) {
+				counts[owner]++
+			}
+			ratio := float64(counts["c"]) / float64(counts["a"]+counts["b"])
+			if ratio < 0.85 || ratio > 1.15 {
+				t.Fatalf("c should own half of the keys %v", counts)
+			}
+		})
+	}
+}
+
+func TestRemapping(t *testing.T) {
+	// the share of the keys moved when an 11th node joins, 1/11 at best
+	maxMoved := map[string]float64{"ring": 0.12, "jump": 0.1, "rendezvous": 0.1, "maglev": 0.12}
+	for _, st := range strategies {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new()
+			nodes := nodeNames(11)
+			s.Add(nodes[:10]...)
+			before := owners(s)
+
+			s.Add(nodes[10])
+			moved := 0
+			for key, owner := range owners(s) {
+				if owner != before[key] {
+					moved++
+					if st.name != "maglev" && owner != nodes[10] {
+						t.Fatalf("%s moved from %s to %s", key, before[key], owner)
+					}
+				}
+			}
+			share := float64(moved) / balanceKeys
+			t.Logf("moved %.3f", share)
+			if share > maxMoved[st.name] {
+				t.Fatalf("%.3f of the keys moved", share)
+			}
+
+			// the last node leaving restores the previous owners, except for maglev which only comes close
+			s.Remove(nodes[10])
+			moved = 0
+			for key, owner := range owners(s) {
+				if owner != before[key] {
+					moved++
+				}
+			}
+			if st.name != "maglev" && moved != 0 || float64(moved)/balanceKeys > 0.02 {
+				t.Fatalf("%d keys didn't come back", moved)
+			}
+		})
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for _, st := range strategies {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new()
+			if s.Get("key") != "" || s.GetN("key", 2) != nil {
+				t.Fatal("an empty strategy should yield nothing")
+			}
+			nodes := nodeNames(5)
+			s.Add(nodes...)
+			for i := 0; i < 100; i++ {
+				key := "key" + strconv.Itoa(i)
+				got := s.GetN(key, 3)
+				if len(got) != 3 || got[0] != s.Get(key) || got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+					t.Fatalf("unexpected owners %v of %s", got, key)
+				}
+			}
+			if got := s.GetN("key", 10); len(got) != 5 {
+				t.Fatalf("expect all the 5 nodes, got %v", got)
+			}
+		})
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// every virtual node collides
+	hash := New(3, func(key []byte) uint32 { return 42 })
+	hash.Add("b", "a")
+	if hash.Get("key") != "a" {
+		t.Fatalf("the colliding nodes should be ordered by name, got %s", hash.Get("key"))
+	}
+	if got := hash.GetN("key", 2); len(got) != 2 {
+		t.Fatalf("both nodes should be kept, got %v", got)
+	}
+	hash.Remove("a")
+	if hash.Get("key") != "b" {
+		t.Fatal("removing a shouldn't remove b")
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, st := range strategies {
+		for _, n := range []int{10, 100} {
+			b.Run(fmt.Sprintf("%s/nodes=%d", st.name, n), func(b *testing.B) {
+				s := st.new()
+				s.Add(nodeNames(n)...)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					s.Get("key" + strconv.Itoa(i&1023))
+				}
+			})
+		}
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	for size, want := range map[int]uint64{0: DefaultMaglevSize, 1: 2, 2: 2, 4: 5, 100: 101, 65536: 65537} {
+		m := NewMaglev(size, nil)
+		if m.size != want {
+			t.Fatalf("size %d: expect %d slots, got %d", size, want, m.size)
+		}
+		// every node gets a slot and all the slots are filled
+		m.Add(nodeNames(3)...)
+		for _, owner := range m.table {
+			if owner < 0 {
+				t.Fatalf("size %d: a slot isn't filled", size)
+			}
+		}
+		if m.Get("key") == "" {
+			t.Fatalf("size %d: expect an owner", size)
+		}
+	}
+}
@@ -4,8 +4,15 @@ import (
 	"beeCache"
 	"flag"
 	"fmt"
+	"github.com/blkcor/beeRPC/registry"
+	"github.com/blkcor/beeRPC/xclient"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -14,7 +21,11 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
-func createGroup() *beeCache.Group {
+func createGroup(snapshot string) *beeCache.Group {
+	var opts []beeCache.Option
+	if snapshot != "" {
+		opts = append(opts, beeCache.WithSnapshot(snapshot, 30*time.Second))
+	}
 	return beeCache.NewGroup("scores", 2<<10, beeCache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
@@ -22,22 +33,63 @@ func createGroup() *beeCache.Group {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), opts...)
 }
 
-func startCacheServer(addr string, addrs []string, bee *beeCache.Group) {
-	peers := beeCache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// cachePeers is the pool of the chosen transport
+type cachePeers interface {
+	beeCache.ReplicaPicker
+	Watch(d beeCache.Discovery, stop <-chan struct{}) error
+	CheckHealth(interval time.Duration, stop <-chan struct{})
+}
+
+func startCacheServer(port int, transport string, d beeCache.Discovery, bee *beeCache.Group, snapshot string, replicas int) {
+	addr := cacheAddr(port, transport)
+	var peers cachePeers
+	var serve func()
+	switch transport {
+	case "rpc":
+		pool := beeCache.NewRPCPool(addr, &beeCache.RPCPoolOptions{Replicas: replicas})
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			log.Fatal(err)
+		}
+		peers, serve = pool, func() { pool.Serve(lis) }
+	default:
+		pool := beeCache.NewHTTPPoolOpts(addr, &beeCache.HTTPPoolOptions{Replicas: replicas})
+		peers, serve = pool, func() { log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), pool)) }
+	}
+	if err := peers.Watch(d, nil); err != nil {
+		log.Fatal(err)
+	}
+	// 宕机的节点会被跳过，恢复后重新加入
+	peers.CheckHealth(time.Second, nil)
 	bee.RegisterPeers(peers)
+	// 热启动：只恢复仍然属于本节点的key
+	if snapshot != "" {
+		n, err := bee.LoadSnapshot(snapshot)
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to load snapshot:", err)
+		}
+		log.Println("Restored", n, "entries from", snapshot)
+	}
 	log.Println("beeCache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	serve()
+}
+
+// cacheAddr is the address of this peer, a beeRPC address with the rpc transport
+func cacheAddr(port int, transport string) string {
+	if transport == "rpc" {
+		return fmt.Sprintf("tcp@localhost:%d", port)
+	}
+	return fmt.Sprintf("http://localhost:%d", port)
 }
 
 func startAPIServer(apiAddr string, bee *beeCache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := bee.Get(key)
+			view, err := bee.GetContext(r.Context(), key)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -54,25 +106,48 @@ func startAPIServer(apiAddr string, bee *beeCache.Group) {
 func main() {
 	var port int
 	var api bool
+	var replicas int
+	var peersFile, registryAddr, snapshot, transport string
 	flag.IntVar(&port, "port", 8001, "BeeCache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&peersFile, "peers", "", "File listing the peers, one per line")
+	flag.StringVar(&registryAddr, "registry", "", "BeeRegistry url, eg. http://localhost:9998/_beerpc_/registry")
+	flag.IntVar(&replicas, "replicas", 1, "Number of peers holding each key")
+	flag.StringVar(&snapshot, "snapshot", "", "File the cache is saved to and restored from")
+	flag.StringVar(&transport, "transport", "http", "Transport between the peers, http or rpc")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	if transport != "http" && transport != "rpc" {
+		log.Fatalf("unknown transport %s, expect http or rpc", transport)
 	}
+	self := cacheAddr(port, transport)
 
-	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	// 节点可以在运行时加入或离开
+	var d beeCache.Discovery = beeCache.StaticDiscovery{self}
+	switch {
+	case registryAddr != "":
+		registry.HeartBeats(registryAddr, self, 0)
+		if transport == "rpc" {
+			d = beeCache.NewXClientDiscovery(xclient.NewBeeRegistryDiscovery(registryAddr, time.Second), time.Second)
+		} else {
+			d = beeCache.NewRegistryDiscovery(registryAddr, time.Second)
+		}
+	case peersFile != "":
+		d = beeCache.NewFileDiscovery(peersFile, time.Second)
 	}
 
-	bee := createGroup()
+	bee := createGroup(snapshot)
+	// 退出前保存快照
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		bee.Close()
+		os.Exit(0)
+	}()
 	if api {
 		go startAPIServer(apiAddr, bee)
 	}
-	startCacheServer(addrMap[port], addrs, bee)
+	startCacheServer(port, transport, d, bee, snapshot, replicas)
 }
@@ -1,10 +1,11 @@
 #!/bin/bash
-trap "rm server;kill 0" EXIT
+trap "rm server peers;kill 0" EXIT
 
 go build -o server
-./server -port=8001 &
-./server -port=8002 &
-./server -port=8003 -api=1 &
+printf "http://localhost:8001\nhttp://localhost:8002\nhttp://localhost:8003\n" > peers
+./server -port=8001 -peers=peers &
+./server -port=8002 -peers=peers &
+./server -port=8003 -peers=peers -api=1 &
 
 sleep 2
 echo ">>> start test"
@@ -12,4 +13,12 @@ curl "http://localhost:9999/api?key=Tom" &
 curl "http://localhost:9999/api?key=Tom" &
 curl "http://localhost:9999/api?key=Tom" &
 
-wait
\ No newline at end of file
+sleep 2
+echo ">>> a peer joins"
+./server -port=8004 -peers=peers &
+echo "http://localhost:8004" >> peers
+
+sleep 3
+curl "http://localhost:9999/api?key=Jack" &
+
+wait
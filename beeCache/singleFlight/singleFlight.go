@@ -1,11 +1,40 @@
 package singleFlight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrGoexit is the error of the waiters when fn called runtime.Goexit
+var ErrGoexit = errors.New("singleFlight: fn called runtime.Goexit")
+
+// PanicError is the error of the waiters when fn panicked, Do and DoContext panic with it again
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleFlight: fn panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Result is the result of DoChan
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // whether Val was given to several callers
+}
 
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	wg    sync.WaitGroup
+	val   interface{}
+	err   error
+	dups  int
+	chans []chan<- Result
 }
 
 type Group struct {
@@ -13,7 +42,10 @@ type Group struct {
 	m  map[string]*call
 }
 
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// Do calls fn once for all the concurrent callers of the same key, they all get its result and error.
+// shared reports whether the result was given to several callers. If fn panics or calls runtime.Goexit,
+// so do all the callers.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	// 加锁并且初始化
 	g.mu.Lock()
 	if g.m == nil {
@@ -22,10 +54,16 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 
 	// 判断是否有相同的key正在被调用
 	if c, ok := g.m[key]; ok {
+		c.dups++
 		g.mu.Unlock()
 		// 存在相同的key，等待调用完成
 		c.wg.Wait()
-		return c.val, nil
+		if p, ok := c.err.(*PanicError); ok {
+			panic(p)
+		} else if c.err == ErrGoexit {
+			runtime.Goexit()
+		}
+		return c.val, c.err, true
 	}
 
 	// 不存在相同的key，新建一个call
@@ -34,13 +72,123 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	g.doCall(c, key, fn)
+	if p, ok := c.err.(*PanicError); ok {
+		panic(p)
+	}
+	return c.val, c.err, c.dups > 0
+}
 
-	//清理函数，防止内存泄漏
+// DoChan is like Do but returns a channel receiving the result, fn runs in its own goroutine.
+// A panic of fn is received as a *PanicError.
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext is like Do but stops waiting once ctx is done and returns its error,
+// fn keeps running for the other callers and its result is still shared
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	if ctx.Done() == nil {
+		// ctx is never done, fn runs in the goroutine of the caller
+		return g.Do(key, fn)
+	}
+	select {
+	case r := <-g.DoChan(key, fn):
+		if p, ok := r.Err.(*PanicError); ok {
+			panic(p)
+		}
+		return r.Val, r.Err, r.Shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+// Lead starts a call for the key if none is in flight, the caller computes its result and gives it to done.
+// Meanwhile the other callers of the key wait for it, like for fn. ok is false if a call was already in flight.
+// It lets a caller lead the calls of several keys at once, eg. to load them in one batch.
+func (g *Group) Lead(key string) (done func(v interface{}, err error), ok bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if _, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		return nil, false
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	var once sync.Once
+	return func(v interface{}, err error) {
+		once.Do(func() {
+			c.val, c.err = v, err
+			g.finish(c, key)
+		})
+	}, true
+}
+
+// Forget forgets the call in flight for the key, the next callers call fn again instead of waiting for it.
+// The callers already waiting still get its result.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
+
+// doCall runs fn, recovers its panic and records a runtime.Goexit, then wakes up the waiters
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	returned := false
+	defer func() {
+		// 既没有返回也没有 panic，说明 fn 调用了 runtime.Goexit
+		if !returned && c.err == nil {
+			c.err = ErrGoexit
+		}
+		g.finish(c, key)
+	}()
 
-	return c.val, c.err
+	func() {
+		defer func() {
+			if !returned {
+				if r := recover(); r != nil {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		returned = true
+	}()
+}
+
+// finish wakes up the waiters of the call once its result is set
+func (g *Group) finish(c *call, key string) {
+	c.wg.Done()
+
+	//清理函数，防止内存泄漏
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	for _, ch := range c.chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+	}
+	g.mu.Unlock()
 }
@@ -0,0 +1,226 @@
+package singleFlight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dups starts n callers of key blocked in fn until release is closed, it waits for them all to join the call
+func dups(t *testing.T, g *Group, n int, fn func() (interface{}, error)) (release chan struct{}, results chan Result) {
+	release = make(chan struct{})
+	results = make(chan Result, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					results <- Result{Err: r.(error)}
+				}
+			}()
+			v, err, shared := g.Do("key", func() (interface{}, error) {
+				<-release
+				return fn()
+			})
+			results <- Result{Val: v, Err: err, Shared: shared}
+		}()
+	}
+	deadline := time.After(time.Second)
+	for {
+		g.mu.Lock()
+		joined := g.m["key"] != nil && g.m["key"].dups == n-1
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("the callers didn't join the call")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release, results := dups(t, &g, 5, func() (interface{}, error) {
+		calls.Add(1)
+		return "bar", nil
+	})
+	close(release)
+	for i := 0; i < 5; i++ {
+		if r := <-results; r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expect fn called once, got %d", calls.Load())
+	}
+	if v, _, shared := g.Do("key", func() (interface{}, error) { return "baz", nil }); v != "baz" || shared {
+		t.Fatalf("expect a new call, got %v %v", v, shared)
+	}
+}
+
+func TestDoErr(t *testing.T) {
+	var g Group
+	errSource := errors.New("source is down")
+	release, results := dups(t, &g, 3, func() (interface{}, error) {
+		return nil, errSource
+	})
+	close(release)
+	for i := 0; i < 3; i++ {
+		if r := <-results; r.Err != errSource {
+			t.Fatalf("every caller should get the error, got %+v", r)
+		}
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release, results := dups(t, &g, 3, func() (interface{}, error) {
+		panic("boom")
+	})
+	close(release)
+	for i := 0; i < 3; i++ {
+		r := <-results
+		var p *PanicError
+		if !errors.As(r.Err, &p) || p.Value != "boom" {
+			t.Fatalf("every caller should panic, got %+v", r)
+		}
+	}
+	if len(g.m) != 0 {
+		t.Fatal("the call should be forgotten")
+	}
+}
+
+func TestDoGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	exited := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			returned := false
+			defer func() { exited <- !returned }()
+			g.Do("key", func() (interface{}, error) {
+				<-release
+				runtime.Goexit()
+				return nil, nil
+			})
+			returned = true
+		}()
+	}
+	for {
+		g.mu.Lock()
+		joined := g.m["key"] != nil && g.m["key"].dups == 1
+		g.mu.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if !<-exited {
+			t.Fatal("every caller should exit")
+		}
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	ch1, ch2 := g.DoChan("key", fn), g.DoChan("key", fn)
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		if r := <-ch; r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+
+	r := <-g.DoChan("panic", func() (interface{}, error) { panic("boom") })
+	if _, ok := r.Err.(*PanicError); !ok {
+		t.Fatalf("expect a PanicError, got %v", r.Err)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "bar", nil
+	}
+	ch := g.DoChan("key", fn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); err != context.DeadlineExceeded {
+		t.Fatalf("expect the deadline exceeded, got %v", err)
+	}
+	// the call keeps running for the others
+	close(release)
+	if r := <-ch; r.Val != "bar" || calls.Load() != 1 {
+		t.Fatalf("unexpected result %+v after %d calls", r, calls.Load())
+	}
+	if v, err, _ := g.DoContext(context.Background(), "key", fn); v != "bar" || err != nil {
+		t.Fatalf("unexpected result %v %v", v, err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	releaseFirst, releaseSecond := make(chan struct{}), make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-releaseFirst
+		return "stale", nil
+	})
+	g.Forget("key")
+	second := g.DoChan("key", func() (interface{}, error) {
+		<-releaseSecond
+		return "fresh", nil
+	})
+
+	close(releaseFirst)
+	if r := <-first; r.Val != "stale" || r.Shared {
+		t.Fatalf("the forgotten call should still deliver its result, got %+v", r)
+	}
+	// the forgotten call doesn't remove the newer one, a caller joins it
+	third := g.DoChan("key", func() (interface{}, error) { return "third", nil })
+	close(releaseSecond)
+	for _, ch := range []<-chan Result{second, third} {
+		if r := <-ch; r.Val != "fresh" || !r.Shared {
+			t.Fatalf("expect the newer call shared, got %+v", r)
+		}
+	}
+}
+
+func TestLead(t *testing.T) {
+	var g Group
+	done, ok := g.Lead("key")
+	if !ok {
+		t.Fatal("expect to lead the call")
+	}
+	if _, ok := g.Lead("key"); ok {
+		t.Fatal("a call is already in flight")
+	}
+	ch := g.DoChan("key", func() (interface{}, error) {
+		t.Error("fn shouldn't be called while the call is led")
+		return nil, nil
+	})
+	done("bar", nil)
+	done("ignored", nil)
+	if r := <-ch; r.Val != "bar" || !r.Shared {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if _, ok := g.Lead("key"); !ok {
+		t.Fatal("the call should be over")
+	}
+}
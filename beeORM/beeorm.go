@@ -1,6 +1,7 @@
 package beeorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/blkcor/beeORM/dialect"
@@ -69,6 +70,11 @@ func (e *Engine) Close() {
 	log.Info("Close database successful!")
 }
 
+// PingContext verifies the database connection is still alive, it's useful for health checks
+func (e *Engine) PingContext(ctx context.Context) error {
+	return e.db.PingContext(ctx)
+}
+
 // NewSession creates a new session for database operations
 func (e *Engine) NewSession() *session.Session {
 	return session.New(e.db, e.dialect)
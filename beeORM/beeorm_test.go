@@ -1,6 +1,7 @@
 package beeorm
 
 import (
+	"context"
 	"errors"
 	"github.com/blkcor/beeORM/session"
 	_ "github.com/mattn/go-sqlite3"
@@ -87,3 +88,14 @@ func TestEngine_Migrate(t *testing.T) {
 		t.Fatal("Failed to migrate table User, got columns", columns)
 	}
 }
+
+func TestEngine_PingContext(t *testing.T) {
+	engine := OpenDB(t)
+	if err := engine.PingContext(context.Background()); err != nil {
+		t.Fatal("failed to ping", err)
+	}
+	engine.Close()
+	if err := engine.PingContext(context.Background()); err == nil {
+		t.Fatal("ping on a closed engine should fail")
+	}
+}
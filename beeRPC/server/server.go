@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -104,7 +105,8 @@ func (srv *Server) ServerConn(conn net.Conn) {
 	// Option使用json进行编码和解码
 	var option Option
 	// 阻塞等待客户端发送Option
-	if err := json.NewDecoder(conn).Decode(&option); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&option); err != nil {
 		log.Println("rpc server: options error: ", err)
 		return
 	}
@@ -118,7 +120,20 @@ func (srv *Server) ServerConn(conn net.Conn) {
 		log.Printf("rpc server: invalid codec type %s", option.CodecType)
 		return
 	}
-	srv.serveCodec(f(conn), option.HandleTimeout)
+	// 客户端发送Option后可能紧接着发送请求，json解码器预读的部分（去掉Option末尾的换行）要先交给codec
+	buffered, _ := io.ReadAll(dec.Buffered())
+	buffered = bytes.TrimLeft(buffered, " \t\r\n")
+	srv.serveCodec(f(bufferedConn{Reader: io.MultiReader(bytes.NewReader(buffered), conn), Conn: conn}), option.HandleTimeout)
+}
+
+// bufferedConn reads what was buffered before the rest of the connection
+type bufferedConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // invalidRequest is a placeholder for response argv when error occurs
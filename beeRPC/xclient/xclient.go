@@ -34,6 +34,18 @@ func (xc *XClient) Close() error {
 	return nil
 }
 
+// CloseAddr closes the connection cached for rpcAddr, the next call to it dials again
+func (xc *XClient) CloseAddr(rpcAddr string) error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	cli, ok := xc.clients[rpcAddr]
+	if !ok {
+		return nil
+	}
+	delete(xc.clients, rpcAddr)
+	return cli.Close()
+}
+
 func (xc *XClient) Dial(rpcAddr string) (*client.Client, error) {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
@@ -86,6 +98,7 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	var e error
 	replyDone := reply == nil              // if reply is nil, don't need to set value
 	ctx, cancel := context.WithCancel(ctx) //借助 context.WithCancel 确保有错误发生时，快速失败。
+	defer cancel()
 	for _, rpcAddr := range servers {
 		wg.Add(1)
 		go func(rpcAddr string) {